@@ -0,0 +1,96 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"fmt"
+	"sync"
+	"syscall"
+)
+
+// attachMu guards the parent/child links between rings sharing an async
+// worker backend.
+var attachMu sync.Mutex
+
+// NewAttachedRing creates a ring which shares the async worker backend of
+// parent instead of spawning its own. The parent is kept alive while it has
+// attached rings: calling QueueExit on it is deferred until the last attached
+// ring has exited.
+func NewAttachedRing(parent *Ring, entries uint32, options ...RingOption) (*Ring, error) {
+	return NewRingWithOptions(entries, append(options, WithAttachWQ(parent))...)
+}
+
+// AttachedRings returns the number of live rings attached to ring.
+func (ring *Ring) AttachedRings() int {
+	attachMu.Lock()
+	defer attachMu.Unlock()
+
+	return ring.wqChildren
+}
+
+func (ring *Ring) attachTo(parent *Ring) error {
+	attachMu.Lock()
+	defer attachMu.Unlock()
+
+	if parent.wqExiting {
+		return fmt.Errorf("parent ring is exiting: %w", syscall.EBADF)
+	}
+	parent.wqChildren++
+	ring.wqParent = parent
+
+	return nil
+}
+
+func (ring *Ring) detachFromParent() {
+	attachMu.Lock()
+	parent := ring.wqParent
+	if parent == nil {
+		attachMu.Unlock()
+
+		return
+	}
+	ring.wqParent = nil
+	parent.wqChildren--
+	exit := parent.wqChildren == 0 && parent.wqExiting
+	attachMu.Unlock()
+
+	if exit {
+		parent.queueExit()
+	}
+}
+
+// beginExit marks the ring as exiting and reports whether it can be torn
+// down now, i.e. it was not exiting already and no attached rings still
+// depend on it.
+func (ring *Ring) beginExit() bool {
+	attachMu.Lock()
+	defer attachMu.Unlock()
+
+	if ring.wqExiting {
+		return false
+	}
+	ring.wqExiting = true
+
+	return ring.wqChildren == 0
+}
@@ -0,0 +1,92 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"syscall"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func TestNewAttachedRing(t *testing.T) {
+	parent, err := NewRingWithOptions(4)
+	NoError(t, err)
+
+	first, err := NewAttachedRing(parent, 4)
+	NoError(t, err)
+	second, err := NewAttachedRing(parent, 8, WithCQSize(32))
+	NoError(t, err)
+	Equal(t, 2, parent.AttachedRings())
+	params := second.Params()
+	Equal(t, uint32(parent.RingFd()), params.WQFd())
+	Equal(t, uint32(32), params.CQEntries())
+
+	// The parent stays usable until its attached rings are gone.
+	parent.QueueExit()
+	_, err = unixFcntl(parent.RingFd())
+	NoError(t, err)
+
+	_, err = NewAttachedRing(parent, 4)
+	ErrorIs(t, err, syscall.EBADF)
+	Equal(t, 2, parent.AttachedRings())
+
+	NoError(t, queueNOPs(t, first, 2, 0))
+	_, err = first.WaitCQENr(2)
+	NoError(t, err)
+	first.CQAdvance(2)
+
+	first.QueueExit()
+	Equal(t, 1, parent.AttachedRings())
+	_, err = unixFcntl(parent.RingFd())
+	NoError(t, err)
+
+	second.QueueExit()
+	Equal(t, 0, parent.AttachedRings())
+	_, err = unixFcntl(parent.RingFd())
+	ErrorIs(t, err, syscall.EBADF)
+}
+
+func TestNewAttachedRingSetupFailure(t *testing.T) {
+	parent, err := NewRingWithOptions(4)
+	NoError(t, err)
+
+	ring, err := NewAttachedRing(parent, 1<<20)
+	Error(t, err)
+	Nil(t, ring)
+	Equal(t, 0, parent.AttachedRings())
+
+	parent.QueueExit()
+	_, err = unixFcntl(parent.RingFd())
+	ErrorIs(t, err, syscall.EBADF)
+}
+
+func unixFcntl(fd int) (uintptr, error) {
+	ret, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_GETFD, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+
+	return ret, nil
+}
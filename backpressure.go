@@ -0,0 +1,170 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// SQFullPolicy selects what GetSQEWait does when the submission queue is
+// full. All policies first submit the pending entries. GetSQE never
+// submits and returns nil right away.
+type SQFullPolicy uint8
+
+const (
+	// SQFullBlock waits for the kernel to consume entries: on SQPOLL rings
+	// with SQRingWait, or by polling the queue if ctx can be cancelled, as
+	// SQRingWait cannot be interrupted; on other rings by flushing
+	// completions.
+	SQFullBlock SQFullPolicy = iota
+	// SQFullError returns ErrSQFull if submitting made no room.
+	SQFullError
+	// SQFullSpin retries submitting, yielding the processor in between,
+	// and returns ErrSQFull if no room was made after sqFullMaxSpins tries.
+	SQFullSpin
+)
+
+func (p SQFullPolicy) String() string {
+	switch p {
+	case SQFullBlock:
+		return "block"
+	case SQFullError:
+		return "error"
+	case SQFullSpin:
+		return "spin"
+	default:
+		return fmt.Sprintf("SQFullPolicy(%d)", uint8(p))
+	}
+}
+
+// sqFullMaxSpins bounds the number of submits of SQFullSpin.
+const sqFullMaxSpins = 1024
+
+// SetSQFullPolicy sets the policy of GetSQEWait.
+func (ring *Ring) SetSQFullPolicy(policy SQFullPolicy) {
+	ring.sqFullPolicy = policy
+}
+
+// GetSQEWait returns a free entry, applying the SQ full policy if the queue
+// is full. It returns ctx.Err() when ctx is done first, and an error
+// wrapping syscall.EBUSY while a batch is open.
+func (ring *Ring) GetSQEWait(ctx context.Context) (*SubmissionQueueEntry, error) {
+	if sqe := privateGetSQE(ring); sqe != nil {
+		return sqe, nil
+	}
+	if ring.batchOpen {
+		return nil, fmt.Errorf("SQE batch is open: %w", syscall.EBUSY)
+	}
+
+	return ring.getSQEFull(ctx)
+}
+
+func (ring *Ring) getSQEFull(ctx context.Context) (*SubmissionQueueEntry, error) {
+	for spins := 1; ; spins++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		_, err := ring.Submit()
+		if sqe := privateGetSQE(ring); sqe != nil {
+			return sqe, nil
+		}
+		if err != nil && !sqFullTemporary(err) {
+			return nil, err
+		}
+
+		switch ring.sqFullPolicy {
+		case SQFullError:
+			return nil, ErrSQFull
+		case SQFullSpin:
+			if spins >= sqFullMaxSpins {
+				return nil, ErrSQFull
+			}
+			if ring.flags&SetupSQPoll == 0 {
+				_, _ = ring.GetEvents()
+			}
+			runtime.Gosched()
+		default:
+			if ring.flags&SetupSQPoll != 0 {
+				if err = ring.sqPollWait(ctx); err != nil {
+					return nil, err
+				}
+
+				continue
+			}
+
+			// The kernel refused the entries because completions are
+			// waiting for room in the CQ. Flush them; if the CQ is still
+			// full only the caller can make room by reaping it.
+			_, _ = ring.GetEvents()
+			if ring.CQHasOverflow() {
+				return nil, fmt.Errorf("completion queue full, reap completions first: %w", ErrSQFull)
+			}
+		}
+	}
+}
+
+// Bounds of the delay between two checks of the queue in sqPollWait.
+const (
+	sqPollMinBackoff = 10 * time.Microsecond
+	sqPollMaxBackoff = time.Millisecond
+)
+
+// sqPollWait waits for the SQPOLL thread to make room in the queue or for
+// ctx to be done.
+func (ring *Ring) sqPollWait(ctx context.Context) error {
+	if ctx.Done() == nil {
+		_, err := ring.SQRingWait()
+		if err != nil && !sqFullTemporary(err) {
+			return err
+		}
+
+		return nil
+	}
+
+	delay := sqPollMinBackoff
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for ring.SQSpaceLeft() == 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+		delay = min(2*delay, sqPollMaxBackoff)
+		timer.Reset(delay)
+	}
+
+	return nil
+}
+
+func sqFullTemporary(err error) bool {
+	return errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR)
+}
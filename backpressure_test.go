@@ -0,0 +1,160 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func fillSQ(t *testing.T, ring *Ring) {
+	t.Helper()
+
+	for ring.SQSpaceLeft() > 0 {
+		sqe := ring.GetSQE()
+		NotNil(t, sqe)
+		sqe.PrepareNop()
+	}
+}
+
+func TestGetSQEWait(t *testing.T) {
+	ring, err := CreateRing(4)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	fillSQ(t, ring)
+	Nil(t, ring.GetSQE())
+
+	sqe, err := ring.GetSQEWait(context.Background())
+	NoError(t, err)
+	NotNil(t, sqe)
+	sqe.PrepareNop()
+
+	// The full queue was submitted to make room.
+	Equal(t, uint32(4), ring.CQReady())
+	Equal(t, uint32(1), ring.SQReady())
+	ring.CQAdvance(ring.CQReady())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fillSQ(t, ring)
+	_, err = ring.GetSQEWait(ctx)
+	ErrorIs(t, err, context.Canceled)
+}
+
+func TestSQFullPolicy(t *testing.T) {
+	for _, policy := range []SQFullPolicy{SQFullBlock, SQFullError, SQFullSpin} {
+		t.Run(policy.String(), func(t *testing.T) {
+			ring, err := CreateRing(4)
+			NoError(t, err)
+
+			defer ring.QueueExit()
+
+			ring.SetSQFullPolicy(policy)
+			for i := 0; i < 10; i++ {
+				sqe, err := ring.GetSQEWait(context.Background())
+				NoError(t, err)
+				sqe.PrepareNop()
+			}
+			_, err = ring.Submit()
+			NoError(t, err)
+
+			for i := 0; i < 10; i++ {
+				cqe, err := ring.WaitCQE()
+				NoError(t, err)
+				Equal(t, int32(0), cqe.Res)
+				ring.CQESeen(cqe)
+			}
+		})
+	}
+}
+
+func TestSQFullPolicySQPoll(t *testing.T) {
+	ring, err := NewRingWithOptions(4, WithSQPoll(-1, 10*time.Millisecond))
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	for i := 0; i < 16; i++ {
+		sqe, err := ring.GetSQEWait(context.Background())
+		NoError(t, err)
+		sqe.PrepareNop()
+	}
+	_, err = ring.Submit()
+	NoError(t, err)
+
+	_, err = ring.WaitCQENr(16)
+	NoError(t, err)
+}
+
+func TestSQPollWaitContext(t *testing.T) {
+	ring, err := NewRingWithOptions(4, WithSQPoll(-1, 10*time.Millisecond))
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	// The SQPOLL thread cannot consume entries which were not flushed, so
+	// the queue stays full.
+	fillSQ(t, ring)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	ErrorIs(t, ring.sqPollWait(ctx), context.DeadlineExceeded)
+	GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+	Less(t, time.Since(start), time.Second)
+
+	_, err = ring.Submit()
+	NoError(t, err)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	NoError(t, ring.sqPollWait(ctx))
+	NotZero(t, ring.SQSpaceLeft())
+
+	_, err = ring.WaitCQENr(4)
+	NoError(t, err)
+}
+
+func TestGetSQEWaitBatchOpen(t *testing.T) {
+	ring, err := CreateRing(4)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	batch, err := ring.Reserve(4)
+	NoError(t, err)
+	defer batch.Rollback()
+
+	ring.SetSQFullPolicy(SQFullBlock)
+	Nil(t, ring.GetSQE())
+	_, err = ring.GetSQEWait(context.Background())
+	ErrorIs(t, err, syscall.EBUSY)
+}
@@ -0,0 +1,111 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"syscall"
+)
+
+var (
+	// ErrSQFull is returned when the submission queue has no room for the
+	// requested entries.
+	ErrSQFull = fmt.Errorf("submission queue full: %w", syscall.EBUSY)
+	// ErrBatchDone is returned when committing a batch which was already
+	// committed or rolled back.
+	ErrBatchDone = errors.New("SQE batch already committed or rolled back")
+)
+
+// SQEBatch is a group of SQEs reserved with Reserve. The entries only become
+// part of the submission queue on Commit.
+type SQEBatch struct {
+	ring *Ring
+	tail uint32
+	n    uint32
+	done bool
+}
+
+// Reserve reserves n consecutive SQEs. It returns ErrSQFull if the queue
+// lacks space, and EBUSY while another batch is open. GetSQE returns nil
+// until the batch is committed or rolled back.
+func (ring *Ring) Reserve(n uint32) (*SQEBatch, error) {
+	if n == 0 || n > *ring.sqRing.ringEntries {
+		return nil, fmt.Errorf("cannot reserve %d SQEs: %w", n, syscall.EINVAL)
+	}
+	if ring.batchOpen {
+		return nil, fmt.Errorf("another SQE batch is open: %w", syscall.EBUSY)
+	}
+
+	sq := ring.sqRing
+	if sq.sqeTail+n-atomic.LoadUint32(sq.head) > *sq.ringEntries {
+		return nil, ErrSQFull
+	}
+
+	ring.batchOpen = true
+
+	return &SQEBatch{
+		ring: ring,
+		tail: sq.sqeTail,
+		n:    n,
+	}, nil
+}
+
+// Len returns the number of entries in the batch.
+func (b *SQEBatch) Len() int {
+	return int(b.n)
+}
+
+// Entry returns the i-th entry of the batch.
+func (b *SQEBatch) Entry(i int) *SubmissionQueueEntry {
+	if i < 0 || i >= int(b.n) {
+		panic(fmt.Sprintf("SQE batch index %d out of range [0, %d)", i, b.n))
+	}
+
+	return b.ring.sqeAt(b.tail + uint32(i))
+}
+
+// Commit adds the entries to the submission queue, to be sent with the next
+// Submit.
+func (b *SQEBatch) Commit() error {
+	if b.done {
+		return ErrBatchDone
+	}
+	b.done = true
+	b.ring.batchOpen = false
+	b.ring.sqRing.sqeTail = b.tail + b.n
+
+	return nil
+}
+
+// Rollback gives the entries back without submitting them. It does nothing
+// after Commit, so it can be deferred.
+func (b *SQEBatch) Rollback() {
+	if b.done {
+		return
+	}
+	b.done = true
+	b.ring.batchOpen = false
+}
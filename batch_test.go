@@ -0,0 +1,114 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"syscall"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func TestReserveCommit(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	// Move the tail so the batch wraps around the end of the ring.
+	NoError(t, queueNOPs(t, ring, 6, 0))
+	_, err = ring.WaitCQENr(6)
+	NoError(t, err)
+	ring.CQAdvance(6)
+
+	batch, err := ring.Reserve(5)
+	NoError(t, err)
+	defer batch.Rollback()
+
+	Equal(t, 5, batch.Len())
+	Nil(t, ring.GetSQE())
+	_, err = ring.Reserve(1)
+	ErrorIs(t, err, syscall.EBUSY)
+
+	for i := 0; i < batch.Len(); i++ {
+		sqe := batch.Entry(i)
+		sqe.PrepareNop()
+		sqe.UserData = uint64(100 + i)
+		if i < batch.Len()-1 {
+			sqe.Flags |= SqeIOLink
+		}
+	}
+	Panics(t, func() { batch.Entry(5) })
+	Equal(t, uint32(0), ring.SQReady())
+
+	NoError(t, batch.Commit())
+	ErrorIs(t, batch.Commit(), ErrBatchDone)
+	Equal(t, uint32(5), ring.SQReady())
+
+	submitted, err := ring.SubmitAndWait(5)
+	NoError(t, err)
+	Equal(t, uint(5), submitted)
+
+	var seen []uint64
+	for cqe := range ring.Completions() {
+		NoError(t, cqe.Err())
+		seen = append(seen, cqe.UserData)
+	}
+	Equal(t, []uint64{100, 101, 102, 103, 104}, seen)
+}
+
+func TestReserveRollback(t *testing.T) {
+	ring, err := CreateRing(4)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	batch, err := ring.Reserve(3)
+	NoError(t, err)
+	batch.Entry(0).PrepareNop()
+	batch.Rollback()
+	batch.Rollback()
+	ErrorIs(t, batch.Commit(), ErrBatchDone)
+
+	Equal(t, uint32(0), ring.SQReady())
+	submitted, err := ring.Submit()
+	NoError(t, err)
+	Zero(t, submitted)
+
+	NotNil(t, ring.GetSQE())
+	NotNil(t, ring.GetSQE())
+	_, err = ring.Reserve(3)
+	ErrorIs(t, err, ErrSQFull)
+	ErrorIs(t, err, syscall.EBUSY)
+
+	_, err = ring.Reserve(0)
+	ErrorIs(t, err, syscall.EINVAL)
+	_, err = ring.Reserve(5)
+	ErrorIs(t, err, syscall.EINVAL)
+
+	batch, err = ring.Reserve(2)
+	NoError(t, err)
+	NoError(t, batch.Commit())
+	Equal(t, uint32(4), ring.SQReady())
+}
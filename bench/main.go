@@ -24,6 +24,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"runtime"
@@ -57,9 +58,9 @@ func main() {
 
 	for {
 		for i := 0; i < batchSize; i++ {
-			entry := ring.GetSQE()
-			if entry == nil {
-				log.Panic()
+			entry, err := ring.GetSQEWait(context.Background())
+			if err != nil {
+				log.Panic(err)
 			}
 
 			entry.PrepareNop()
@@ -0,0 +1,593 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"fmt"
+	"math/bits"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+var opCodeNames = [...]string{
+	"OpNop",
+	"OpReadv",
+	"OpWritev",
+	"OpFsync",
+	"OpReadFixed",
+	"OpWriteFixed",
+	"OpPollAdd",
+	"OpPollRemove",
+	"OpSyncFileRange",
+	"OpSendmsg",
+	"OpRecvmsg",
+	"OpTimeout",
+	"OpTimeoutRemove",
+	"OpAccept",
+	"OpAsyncCancel",
+	"OpLinkTimeout",
+	"OpConnect",
+	"OpFallocate",
+	"OpOpenat",
+	"OpClose",
+	"OpFilesUpdate",
+	"OpStatx",
+	"OpRead",
+	"OpWrite",
+	"OpFadvise",
+	"OpMadvise",
+	"OpSend",
+	"OpRecv",
+	"OpOpenat2",
+	"OpEpollCtl",
+	"OpSplice",
+	"OpProvideBuffers",
+	"OpRemoveBuffers",
+	"OpTee",
+	"OpShutdown",
+	"OpRenameat",
+	"OpUnlinkat",
+	"OpMkdirat",
+	"OpSymlinkat",
+	"OpLinkat",
+	"OpMsgRing",
+	"OpFsetxattr",
+	"OpSetxattr",
+	"OpFgetxattr",
+	"OpGetxattr",
+	"OpSocket",
+	"OpUringCmd",
+	"OpSendZC",
+	"OpSendMsgZC",
+	"OpReadMultishot",
+	"OpWaitid",
+	"OpFutexWait",
+	"OpFutexWake",
+	"OpFutexWaitv",
+	"OpFixedFdInstall",
+	"OpFtruncate",
+	"OpBind",
+	"OpListen",
+	"OpRecvZC",
+	"OpEpollWait",
+	"OpReadvFixed",
+	"OpWritevFixed",
+	"OpPipe",
+}
+
+var opCodeMinKernel = [...]KernelVersion{
+	OpNop:            {Kernel: 5, Major: 1},
+	OpReadv:          {Kernel: 5, Major: 1},
+	OpWritev:         {Kernel: 5, Major: 1},
+	OpFsync:          {Kernel: 5, Major: 1},
+	OpReadFixed:      {Kernel: 5, Major: 1},
+	OpWriteFixed:     {Kernel: 5, Major: 1},
+	OpPollAdd:        {Kernel: 5, Major: 1},
+	OpPollRemove:     {Kernel: 5, Major: 1},
+	OpSyncFileRange:  {Kernel: 5, Major: 2},
+	OpSendmsg:        {Kernel: 5, Major: 3},
+	OpRecvmsg:        {Kernel: 5, Major: 3},
+	OpTimeout:        {Kernel: 5, Major: 4},
+	OpTimeoutRemove:  {Kernel: 5, Major: 5},
+	OpAccept:         {Kernel: 5, Major: 5},
+	OpAsyncCancel:    {Kernel: 5, Major: 5},
+	OpLinkTimeout:    {Kernel: 5, Major: 5},
+	OpConnect:        {Kernel: 5, Major: 5},
+	OpFallocate:      {Kernel: 5, Major: 6},
+	OpOpenat:         {Kernel: 5, Major: 6},
+	OpClose:          {Kernel: 5, Major: 6},
+	OpFilesUpdate:    {Kernel: 5, Major: 6},
+	OpStatx:          {Kernel: 5, Major: 6},
+	OpRead:           {Kernel: 5, Major: 6},
+	OpWrite:          {Kernel: 5, Major: 6},
+	OpFadvise:        {Kernel: 5, Major: 6},
+	OpMadvise:        {Kernel: 5, Major: 6},
+	OpSend:           {Kernel: 5, Major: 6},
+	OpRecv:           {Kernel: 5, Major: 6},
+	OpOpenat2:        {Kernel: 5, Major: 6},
+	OpEpollCtl:       {Kernel: 5, Major: 6},
+	OpSplice:         {Kernel: 5, Major: 7},
+	OpProvideBuffers: {Kernel: 5, Major: 7},
+	OpRemoveBuffers:  {Kernel: 5, Major: 7},
+	OpTee:            {Kernel: 5, Major: 8},
+	OpShutdown:       {Kernel: 5, Major: 11},
+	OpRenameat:       {Kernel: 5, Major: 11},
+	OpUnlinkat:       {Kernel: 5, Major: 11},
+	OpMkdirat:        {Kernel: 5, Major: 15},
+	OpSymlinkat:      {Kernel: 5, Major: 15},
+	OpLinkat:         {Kernel: 5, Major: 15},
+	OpMsgRing:        {Kernel: 5, Major: 18},
+	OpFsetxattr:      {Kernel: 5, Major: 19},
+	OpSetxattr:       {Kernel: 5, Major: 19},
+	OpFgetxattr:      {Kernel: 5, Major: 19},
+	OpGetxattr:       {Kernel: 5, Major: 19},
+	OpSocket:         {Kernel: 5, Major: 19},
+	OpUringCmd:       {Kernel: 5, Major: 19},
+	OpSendZC:         {Kernel: 6, Major: 0},
+	OpSendMsgZC:      {Kernel: 6, Major: 1},
+	OpReadMultishot:  {Kernel: 6, Major: 7},
+	OpWaitid:         {Kernel: 6, Major: 7},
+	OpFutexWait:      {Kernel: 6, Major: 7},
+	OpFutexWake:      {Kernel: 6, Major: 7},
+	OpFutexWaitv:     {Kernel: 6, Major: 7},
+	OpFixedFdInstall: {Kernel: 6, Major: 8},
+	OpFtruncate:      {Kernel: 6, Major: 9},
+	OpBind:           {Kernel: 6, Major: 11},
+	OpListen:         {Kernel: 6, Major: 11},
+	OpRecvZC:         {Kernel: 6, Major: 15},
+	OpEpollWait:      {Kernel: 6, Major: 15},
+	OpReadvFixed:     {Kernel: 6, Major: 15},
+	OpWritevFixed:    {Kernel: 6, Major: 15},
+	OpPipe:           {Kernel: 6, Major: 16},
+}
+
+var registerOpNames = [...]string{
+	"RegisterBuffers",
+	"UnregisterBuffers",
+	"RegisterFiles",
+	"UnregisterFiles",
+	"RegisterEventFD",
+	"UnregisterEventFD",
+	"RegisterFilesUpdate",
+	"RegisterEventFDAsync",
+	"RegisterProbe",
+	"RegisterPersonality",
+	"UnregisterPersonality",
+	"RegisterRestrictions",
+	"RegisterEnableRings",
+	"RegisterFiles2",
+	"RegisterFilesUpdate2",
+	"RegisterBuffers2",
+	"RegisterBuffersUpdate",
+	"RegisterIOWQAff",
+	"UnregisterIOWQAff",
+	"RegisterIOWQMaxWorkers",
+	"RegisterRingFDs",
+	"UnregisterRingFDs",
+	"RegisterPbufRing",
+	"UnregisterPbufRing",
+	"RegisterSyncCancel",
+	"RegisterFileAllocRange",
+	"RegisterPbufStatus",
+	"RegisterNapi",
+	"UnregisterNapi",
+	"RegisterClock",
+	"RegisterCloneBuffers",
+	"RegisterSendMsgRing",
+	"RegisterZcrxIfq",
+	"RegisterResizeRings",
+	"RegisterMemRegion",
+}
+
+var registerOpMinKernel = [...]KernelVersion{
+	RegisterBuffers:        {Kernel: 5, Major: 1},
+	UnregisterBuffers:      {Kernel: 5, Major: 1},
+	RegisterFiles:          {Kernel: 5, Major: 1},
+	UnregisterFiles:        {Kernel: 5, Major: 1},
+	RegisterEventFD:        {Kernel: 5, Major: 2},
+	UnregisterEventFD:      {Kernel: 5, Major: 2},
+	RegisterFilesUpdate:    {Kernel: 5, Major: 5},
+	RegisterEventFDAsync:   {Kernel: 5, Major: 6},
+	RegisterProbe:          {Kernel: 5, Major: 6},
+	RegisterPersonality:    {Kernel: 5, Major: 6},
+	UnregisterPersonality:  {Kernel: 5, Major: 6},
+	RegisterRestrictions:   {Kernel: 5, Major: 10},
+	RegisterEnableRings:    {Kernel: 5, Major: 10},
+	RegisterFiles2:         {Kernel: 5, Major: 13},
+	RegisterFilesUpdate2:   {Kernel: 5, Major: 13},
+	RegisterBuffers2:       {Kernel: 5, Major: 13},
+	RegisterBuffersUpdate:  {Kernel: 5, Major: 13},
+	RegisterIOWQAff:        {Kernel: 5, Major: 14},
+	UnregisterIOWQAff:      {Kernel: 5, Major: 14},
+	RegisterIOWQMaxWorkers: {Kernel: 5, Major: 15},
+	RegisterRingFDs:        {Kernel: 5, Major: 18},
+	UnregisterRingFDs:      {Kernel: 5, Major: 18},
+	RegisterPbufRing:       {Kernel: 5, Major: 19},
+	UnregisterPbufRing:     {Kernel: 5, Major: 19},
+	RegisterSyncCancel:     {Kernel: 6, Major: 0},
+	RegisterFileAllocRange: {Kernel: 6, Major: 0},
+	RegisterPbufStatus:     {Kernel: 6, Major: 8},
+	RegisterNapi:           {Kernel: 6, Major: 9},
+	UnregisterNapi:         {Kernel: 6, Major: 9},
+	RegisterClock:          {Kernel: 6, Major: 12},
+	RegisterCloneBuffers:   {Kernel: 6, Major: 12},
+	RegisterSendMsgRing:    {Kernel: 6, Major: 13},
+	RegisterZcrxIfq:        {Kernel: 6, Major: 15},
+	RegisterResizeRings:    {Kernel: 6, Major: 13},
+	RegisterMemRegion:      {Kernel: 6, Major: 13},
+}
+
+var setupFlagMinKernel = [...]KernelVersion{
+	{Kernel: 5, Major: 1},  // SetupIOPoll
+	{Kernel: 5, Major: 1},  // SetupSQPoll
+	{Kernel: 5, Major: 1},  // SetupSQAff
+	{Kernel: 5, Major: 5},  // SetupCQSize
+	{Kernel: 5, Major: 6},  // SetupClamp
+	{Kernel: 5, Major: 6},  // SetupAttachWQ
+	{Kernel: 5, Major: 10}, // SetupRDisabled
+	{Kernel: 5, Major: 18}, // SetupSubmitAll
+	{Kernel: 5, Major: 19}, // SetupCoopTaskrun
+	{Kernel: 5, Major: 19}, // SetupTaskrunFlag
+	{Kernel: 5, Major: 19}, // SetupSQE128
+	{Kernel: 5, Major: 19}, // SetupCQE32
+	{Kernel: 6, Major: 0},  // SetupSingleIssuer
+	{Kernel: 6, Major: 1},  // SetupDeferTaskrun
+	{Kernel: 6, Major: 5},  // SetupNoMmap
+	{Kernel: 6, Major: 5},  // SetupRegisteredFdOnly
+}
+
+var featureMinKernel = [...]KernelVersion{
+	{Kernel: 5, Major: 4},  // FeatSingleMMap
+	{Kernel: 5, Major: 5},  // FeatNoDrop
+	{Kernel: 5, Major: 5},  // FeatSubmitStable
+	{Kernel: 5, Major: 6},  // FeatRWCurPos
+	{Kernel: 5, Major: 6},  // FeatCurPersonality
+	{Kernel: 5, Major: 7},  // FeatFastPoll
+	{Kernel: 5, Major: 9},  // FeatPoll32Bits
+	{Kernel: 5, Major: 11}, // FeatSQPollNonfixed
+	{Kernel: 5, Major: 11}, // FeatExtArg
+	{Kernel: 5, Major: 12}, // FeatNativeWorkers
+	{Kernel: 5, Major: 13}, // FeatRcrcTags
+	{Kernel: 5, Major: 17}, // FeatCQESkip
+	{Kernel: 5, Major: 17}, // FeatLinkedFile
+	{Kernel: 6, Major: 3},  // FeatRegRegRing
+	{Kernel: 6, Major: 10}, // FeatRecvsendBundle
+	{Kernel: 6, Major: 12}, // FeatMinTimeout
+	{Kernel: 6, Major: 13}, // FeatRWAttr
+	{Kernel: 6, Major: 15}, // FeatNoIOWait
+}
+
+type flagCapability struct {
+	name      string
+	op        uint8
+	minKernel KernelVersion
+}
+
+var recvsendFlagCapabilities = map[uint16]flagCapability{
+	RecvsendPollFirst: {name: "RecvsendPollFirst", op: OpRecv, minKernel: KernelVersion{Kernel: 5, Major: 19}},
+	RecvMultishot:     {name: "RecvMultishot", op: OpRecv, minKernel: KernelVersion{Kernel: 6, Major: 0}},
+	RecvsendFixedBuf:  {name: "RecvsendFixedBuf", op: OpSendZC, minKernel: KernelVersion{Kernel: 6, Major: 0}},
+	SendZCReportUsage: {name: "SendZCReportUsage", op: OpSendZC, minKernel: KernelVersion{Kernel: 6, Major: 2}},
+}
+
+// OpCodeName returns the name of the Op* constant with the given value.
+func OpCodeName(op uint8) string {
+	if int(op) < len(opCodeNames) {
+		return opCodeNames[op]
+	}
+
+	return fmt.Sprintf("Op(%d)", op)
+}
+
+// RegisterOpName returns the name of the Register* constant with the given
+// value.
+func RegisterOpName(op uint32) string {
+	if int(op) < len(registerOpNames) {
+		return registerOpNames[op]
+	}
+
+	return fmt.Sprintf("RegisterOp(%d)", op)
+}
+
+// UnsupportedError is returned by Capabilities when the running kernel lacks
+// a feature. It matches syscall.EOPNOTSUPP with errors.Is.
+type UnsupportedError struct {
+	Feature   string
+	MinKernel KernelVersion
+}
+
+func (e *UnsupportedError) Error() string {
+	if e.MinKernel.Kernel == 0 {
+		return fmt.Sprintf("%s is not supported by this kernel", e.Feature)
+	}
+
+	return fmt.Sprintf("%s is not supported by this kernel, it requires Linux %d.%d or newer",
+		e.Feature, e.MinKernel.Kernel, e.MinKernel.Major)
+}
+
+func (e *UnsupportedError) Unwrap() error {
+	return syscall.EOPNOTSUPP
+}
+
+// Capabilities describes what the running kernel supports. It combines the
+// opcode probe, the ring features, the accepted setup flags and the kernel
+// version.
+type Capabilities struct {
+	Kernel     KernelVersion
+	Features   FeatureSet
+	SetupFlags SetupFlags
+
+	probe       *Probe
+	registerOps uint64
+}
+
+var (
+	capabilitiesOnce sync.Once
+	capabilities     *Capabilities
+	capabilitiesErr  error
+)
+
+// GetCapabilities detects the capabilities of the running kernel. Detection
+// runs once per process and the result is shared.
+func GetCapabilities() (*Capabilities, error) {
+	capabilitiesOnce.Do(func() {
+		capabilities, capabilitiesErr = detectCapabilities()
+	})
+
+	return capabilities, capabilitiesErr
+}
+
+func detectCapabilities() (*Capabilities, error) {
+	kernel, err := GetKernelVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	ring, err := CreateRing(probeEntries)
+	if err != nil {
+		return nil, err
+	}
+	defer ring.QueueExit()
+
+	caps := &Capabilities{
+		Kernel:   *kernel,
+		Features: FeatureSet(ring.features),
+	}
+
+	// Kernels older than 5.6 can't be probed, the version tables are used
+	// instead.
+	probe, err := ring.GetProbeRing()
+	if err == nil {
+		caps.probe = probe
+	}
+	caps.registerOps = probeRegisterOps(ring)
+
+	for bit := range setupFlagNames {
+		flag := uint32(1) << bit
+		if probeSetupFlag(flag, caps.Kernel) {
+			caps.SetupFlags |= SetupFlags(flag)
+		}
+	}
+
+	return caps, nil
+}
+
+// probeRegisterOps calls every known register opcode on the ring with
+// arguments the kernel cannot use: no arguments at all, then an unreadable
+// page with the argument counts the opcodes expect. The kernel rejects
+// unknown opcodes with EINVAL, so any other result proves that the opcode
+// is known. Known opcodes reject some arguments with EINVAL too, so opcodes
+// failing every attempt with EINVAL are not recorded.
+func probeRegisterOps(ring *Ring) uint64 {
+	page, err := unix.Mmap(-1, 0, os.Getpagesize(), unix.PROT_NONE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
+	if err != nil {
+		return 0
+	}
+	defer unix.Munmap(page)
+
+	unreadable := unsafe.Pointer(&page[0])
+	attempts := []struct {
+		arg    unsafe.Pointer
+		nrArgs uint32
+	}{
+		{nil, 0},
+		{unreadable, 0},
+		{unreadable, 1},
+		{unreadable, 2},
+		{unreadable, uint32(unsafe.Sizeof(RsrcRegister{}))},
+		{unreadable, uint32(unsafe.Sizeof(RsrcUpdate2{}))},
+	}
+
+	var ops uint64
+	for op := range registerOpMinKernel {
+		for _, attempt := range attempts {
+			_, errno := ring.doRegisterErrno(uint32(op), attempt.arg, attempt.nrArgs)
+			if errno != syscall.EINVAL {
+				ops |= 1 << op
+
+				break
+			}
+		}
+	}
+
+	return ops
+}
+
+// probeSetupFlag creates a throwaway ring with the flag and whatever it
+// depends on. Flags that need caller supplied memory are checked against the
+// kernel version only.
+func probeSetupFlag(flag uint32, kernel KernelVersion) bool {
+	params := &Params{flags: flag}
+
+	switch flag {
+	case SetupNoMmap, SetupRegisteredFdOnly:
+		return !kernelOlderThan(kernel, setupFlagMinKernel[bits.TrailingZeros32(flag)])
+	case SetupSQAff:
+		params.flags |= SetupSQPoll
+	case SetupCQSize:
+		params.cqEntries = probeEntries * cqEntriesMultiplier
+	case SetupTaskrunFlag:
+		params.flags |= SetupCoopTaskrun
+	case SetupDeferTaskrun:
+		params.flags |= SetupSingleIssuer
+	case SetupAttachWQ:
+		parentFd, ok := setupThrowaway(&Params{})
+		if !ok {
+			return false
+		}
+		defer syscall.Close(parentFd)
+
+		params.wqFd = uint32(parentFd)
+	}
+
+	fd, ok := setupThrowaway(params)
+	if ok {
+		syscall.Close(fd)
+	}
+
+	return ok
+}
+
+func setupThrowaway(p *Params) (int, bool) {
+	fd, _, errno := syscall.Syscall(sysSetup, uintptr(probeEntries), uintptr(unsafe.Pointer(p)), 0)
+	if errno != 0 {
+		return -1, false
+	}
+
+	return int(fd), true
+}
+
+func kernelOlderThan(kernel, minKernel KernelVersion) bool {
+	return CompareKernelVersion(kernel, minKernel) < 0
+}
+
+func unsupported(feature string, minKernel KernelVersion) error {
+	return &UnsupportedError{Feature: feature, MinKernel: minKernel}
+}
+
+// Supports returns nil if the opcode is supported, or an *UnsupportedError.
+func (c *Capabilities) Supports(op uint8) error {
+	if int(op) >= len(opCodeMinKernel) {
+		if c.probe != nil && c.probe.IsSupported(op) {
+			return nil
+		}
+
+		return unsupported(OpCodeName(op), KernelVersion{})
+	}
+
+	minKernel := opCodeMinKernel[op]
+	if c.probe != nil {
+		if c.probe.IsSupported(op) {
+			return nil
+		}
+	} else if !kernelOlderThan(c.Kernel, minKernel) {
+		return nil
+	}
+
+	return unsupported(OpCodeName(op), minKernel)
+}
+
+// SupportsRegister returns nil if the Register* opcode is supported, or an
+// *UnsupportedError. Opcodes which the kernel accepted during detection are
+// supported; for the others, whose probe is inconclusive, the kernel version
+// decides.
+func (c *Capabilities) SupportsRegister(op uint32) error {
+	if int(op) >= len(registerOpMinKernel) {
+		return unsupported(RegisterOpName(op), KernelVersion{})
+	}
+	if c.registerOps&(1<<op) != 0 {
+		return nil
+	}
+
+	minKernel := registerOpMinKernel[op]
+	if kernelOlderThan(c.Kernel, minKernel) {
+		return unsupported(RegisterOpName(op), minKernel)
+	}
+
+	return nil
+}
+
+// SupportsSetupFlag returns nil if the kernel accepts all the given Setup*
+// flags, or an *UnsupportedError naming the first missing one.
+func (c *Capabilities) SupportsSetupFlag(flags uint32) error {
+	for bit := 0; flags != 0; bit++ {
+		flag := uint32(1) << bit
+		if flags&flag == 0 {
+			continue
+		}
+		flags &^= flag
+
+		if bit >= len(setupFlagNames) {
+			return unsupported(fmt.Sprintf("setup flag %#x", flag), KernelVersion{})
+		}
+		if !c.SetupFlags.Has(flag) {
+			return unsupported("Setup"+setupFlagNames[bit], setupFlagMinKernel[bit])
+		}
+	}
+
+	return nil
+}
+
+// SupportsFeature returns nil if the kernel reports all the given Feat*
+// flags, or an *UnsupportedError naming the first missing one.
+func (c *Capabilities) SupportsFeature(features uint32) error {
+	for bit := 0; features != 0; bit++ {
+		feature := uint32(1) << bit
+		if features&feature == 0 {
+			continue
+		}
+		features &^= feature
+
+		if bit >= len(featureNames) {
+			return unsupported(fmt.Sprintf("feature %#x", feature), KernelVersion{})
+		}
+		if !c.Features.Has(feature) {
+			return unsupported("Feat"+featureNames[bit], featureMinKernel[bit])
+		}
+	}
+
+	return nil
+}
+
+// SupportsFlag returns nil if the send/receive ioprio flag, like
+// RecvMultishot or RecvsendPollFirst, is supported, or an *UnsupportedError.
+func (c *Capabilities) SupportsFlag(flag uint16) error {
+	capability, ok := recvsendFlagCapabilities[flag]
+	if !ok {
+		return unsupported(fmt.Sprintf("flag %#x", flag), KernelVersion{})
+	}
+
+	if err := c.Supports(capability.op); err != nil {
+		return err
+	}
+	if kernelOlderThan(c.Kernel, capability.minKernel) {
+		return unsupported(capability.name, capability.minKernel)
+	}
+
+	return nil
+}
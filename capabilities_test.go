@@ -0,0 +1,113 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"syscall"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func TestGetCapabilities(t *testing.T) {
+	caps, err := GetCapabilities()
+	NoError(t, err)
+	NotNil(t, caps)
+
+	again, err := GetCapabilities()
+	NoError(t, err)
+	Same(t, caps, again)
+
+	NoError(t, caps.Supports(OpNop))
+	NoError(t, caps.SupportsRegister(RegisterProbe))
+	NoError(t, caps.SupportsSetupFlag(SetupCQSize|SetupClamp))
+	NoError(t, caps.SupportsFeature(FeatSingleMMap))
+
+	err = caps.Supports(255)
+	ErrorIs(t, err, syscall.EOPNOTSUPP)
+
+	var unsupportedErr *UnsupportedError
+	ErrorAs(t, err, &unsupportedErr)
+	Equal(t, "Op(255)", unsupportedErr.Feature)
+
+	ErrorIs(t, caps.SupportsSetupFlag(1<<31), syscall.EOPNOTSUPP)
+
+	// Probed opcodes are supported whatever the kernel version says.
+	NotZero(t, caps.registerOps&(1<<RegisterProbe))
+	NotZero(t, caps.registerOps&(1<<RegisterFiles2))
+	backported := *caps
+	backported.Kernel = KernelVersion{Kernel: 5, Major: 1}
+	NoError(t, backported.SupportsRegister(RegisterFiles2))
+}
+
+func TestCapabilitiesVersionFallback(t *testing.T) {
+	caps := &Capabilities{
+		Kernel:     KernelVersion{Kernel: 5, Major: 4},
+		Features:   FeatureSet(FeatSingleMMap),
+		SetupFlags: SetupFlags(SetupIOPoll | SetupSQPoll | SetupSQAff),
+	}
+
+	NoError(t, caps.Supports(OpTimeout))
+	NoError(t, caps.SupportsSetupFlag(SetupSQPoll|SetupSQAff))
+
+	var unsupportedErr *UnsupportedError
+
+	err := caps.Supports(OpSendZC)
+	ErrorAs(t, err, &unsupportedErr)
+	Equal(t, "OpSendZC", unsupportedErr.Feature)
+	Equal(t, KernelVersion{Kernel: 6, Major: 0}, unsupportedErr.MinKernel)
+	Equal(t, "OpSendZC is not supported by this kernel, it requires Linux 6.0 or newer", err.Error())
+
+	err = caps.SupportsRegister(RegisterPbufRing)
+	ErrorAs(t, err, &unsupportedErr)
+	Equal(t, "RegisterPbufRing", unsupportedErr.Feature)
+
+	err = caps.SupportsSetupFlag(SetupSingleIssuer | SetupDeferTaskrun)
+	ErrorAs(t, err, &unsupportedErr)
+	Equal(t, "SetupSingleIssuer", unsupportedErr.Feature)
+
+	err = caps.SupportsFeature(FeatExtArg)
+	ErrorAs(t, err, &unsupportedErr)
+	Equal(t, "FeatExtArg", unsupportedErr.Feature)
+	Equal(t, KernelVersion{Kernel: 5, Major: 11}, unsupportedErr.MinKernel)
+
+	err = caps.SupportsFlag(RecvMultishot)
+	ErrorAs(t, err, &unsupportedErr)
+	Equal(t, "OpRecv", unsupportedErr.Feature)
+
+	caps.Kernel = KernelVersion{Kernel: 5, Major: 19}
+	err = caps.SupportsFlag(RecvMultishot)
+	ErrorAs(t, err, &unsupportedErr)
+	Equal(t, "RecvMultishot", unsupportedErr.Feature)
+	NoError(t, caps.SupportsFlag(RecvsendPollFirst))
+}
+
+func TestOpCodeName(t *testing.T) {
+	Equal(t, "OpNop", OpCodeName(OpNop))
+	Equal(t, "OpSendMsgZC", OpCodeName(OpSendMsgZC))
+	Equal(t, "OpPipe", OpCodeName(OpPipe))
+	Equal(t, "Op(255)", OpCodeName(255))
+	Equal(t, "RegisterFileAllocRange", RegisterOpName(RegisterFileAllocRange))
+	Equal(t, "RegisterOp(255)", RegisterOpName(255))
+}
@@ -0,0 +1,437 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// User data of the requests submitted by Chain carry chainUserDataTag in
+// the top byte. Applications must not use user data values with this top
+// byte on rings where chains are used.
+const (
+	chainUserDataTag   uint64 = 0xfc << 56
+	chainUserDataMask  uint64 = 0xff << 56
+	chainIDShift              = 18
+	chainIDMask        uint64 = 1<<38 - 1
+	chainKindShift            = 16
+	chainKindMask      uint64 = 3
+	chainIndexMask     uint64 = 1<<16 - 1
+	chainKindLink      uint64 = 0
+	chainKindTimeout   uint64 = 1
+	chainKindCancel    uint64 = 2
+	chainMaxLinks             = 1 << 16
+	chainNoFailedLink         = -1
+	chainCancelTimeout        = time.Second
+)
+
+var chainIDs atomic.Uint64
+
+// ErrChainSubmitted is returned when a chain is changed or submitted after
+// it was submitted.
+var ErrChainSubmitted = errors.New("chain already submitted")
+
+type chainLink struct {
+	prep    func(sqe *SubmissionQueueEntry)
+	hard    bool
+	timeout time.Duration
+	opCode  uint8
+}
+
+// Chain builds a sequence of linked requests. Each link starts only after
+// the previous one completed. With Add a failing link cancels the rest of
+// the chain, with AddHard the chain continues after failures.
+type Chain struct {
+	ring      *Ring
+	id        uint64
+	links     []chainLink
+	timespecs []syscall.Timespec
+	deadline  time.Time
+	submitted bool
+
+	results   []LinkResult
+	done      []bool
+	aborted   []bool
+	pending   int
+	cancelled bool
+	expired   bool
+}
+
+// NewChain returns an empty chain for the ring.
+func (ring *Ring) NewChain() *Chain {
+	return &Chain{
+		ring: ring,
+		id:   chainIDs.Add(1) & chainIDMask,
+	}
+}
+
+// Add appends a link. prep prepares the request; the user data and link
+// flags it sets are overwritten.
+func (c *Chain) Add(prep func(sqe *SubmissionQueueEntry)) *Chain {
+	c.links = append(c.links, chainLink{prep: prep})
+
+	return c
+}
+
+// AddHard appends a link whose failure does not cancel the following links.
+func (c *Chain) AddHard(prep func(sqe *SubmissionQueueEntry)) *Chain {
+	c.links = append(c.links, chainLink{prep: prep, hard: true})
+
+	return c
+}
+
+// LinkTimeout limits the time the last added link may take. When it
+// expires the link is cancelled.
+func (c *Chain) LinkTimeout(timeout time.Duration) *Chain {
+	if len(c.links) > 0 {
+		c.links[len(c.links)-1].timeout = timeout
+	}
+
+	return c
+}
+
+// Deadline sets a deadline for the whole chain, enforced by Wait, which
+// cancels the pending links once it passes.
+func (c *Chain) Deadline(deadline time.Time) *Chain {
+	c.deadline = deadline
+
+	return c
+}
+
+// Len returns the number of links.
+func (c *Chain) Len() int {
+	return len(c.links)
+}
+
+// Submit prepares the chain in the submission queue and submits it. Either
+// all its requests are queued or none are.
+func (c *Chain) Submit() error {
+	if c.submitted {
+		return ErrChainSubmitted
+	}
+	if len(c.links) == 0 || len(c.links) > chainMaxLinks {
+		return fmt.Errorf("chain of %d links: %w", len(c.links), syscall.EINVAL)
+	}
+
+	var timeouts int
+	for _, link := range c.links {
+		if link.timeout > 0 {
+			timeouts++
+		}
+	}
+
+	batch, err := c.ring.Reserve(uint32(len(c.links) + timeouts))
+	if err != nil {
+		return err
+	}
+	defer batch.Rollback()
+
+	c.timespecs = make([]syscall.Timespec, 0, timeouts)
+	entry := 0
+	for i := range c.links {
+		link := &c.links[i]
+		last := i == len(c.links)-1
+
+		sqe := batch.Entry(entry)
+		entry++
+		link.prep(sqe)
+		link.opCode = sqe.OpCode
+		sqe.UserData = c.userData(chainKindLink, i)
+		sqe.Flags &^= SqeIOLink | SqeIOHardlink
+		switch {
+		case link.hard && (!last || link.timeout > 0):
+			sqe.Flags |= SqeIOHardlink
+		case !last || link.timeout > 0:
+			sqe.Flags |= SqeIOLink
+		}
+
+		if link.timeout > 0 {
+			c.timespecs = append(c.timespecs, syscall.NsecToTimespec(link.timeout.Nanoseconds()))
+			sqe = batch.Entry(entry)
+			entry++
+			sqe.prepareRW(OpLinkTimeout, -1, uintptr(unsafe.Pointer(&c.timespecs[len(c.timespecs)-1])), 1, 0)
+			sqe.UserData = c.userData(chainKindTimeout, i)
+			if !last {
+				sqe.Flags |= SqeIOLink
+			}
+		}
+	}
+
+	err = batch.Commit()
+	if err != nil {
+		return err
+	}
+
+	c.submitted = true
+	c.results = make([]LinkResult, len(c.links))
+	c.done = make([]bool, len(c.links))
+	c.aborted = make([]bool, len(c.links))
+	c.pending = len(c.links) + timeouts
+
+	_, err = c.ring.Submit()
+	runtime.KeepAlive(c.timespecs)
+
+	return err
+}
+
+func (c *Chain) userData(kind uint64, index int) uint64 {
+	return chainUserDataTag | c.id<<chainIDShift | kind<<chainKindShift | uint64(index)
+}
+
+// Owns reports whether the completion belongs to the chain.
+func (c *Chain) Owns(cqe *CompletionQueueEvent) bool {
+	return cqe.UserData&chainUserDataMask == chainUserDataTag &&
+		(cqe.UserData>>chainIDShift)&chainIDMask == c.id
+}
+
+// Handle records a completion of the chain, for event loops which reap
+// completions themselves. It returns false for completions which do not
+// belong to the chain. The caller still marks the event as seen.
+func (c *Chain) Handle(cqe *CompletionQueueEvent) bool {
+	if !c.submitted || !c.Owns(cqe) {
+		return false
+	}
+
+	index := int(cqe.UserData & chainIndexMask)
+	if index >= len(c.links) {
+		return true
+	}
+
+	switch (cqe.UserData >> chainKindShift) & chainKindMask {
+	case chainKindLink:
+		result := &c.results[index]
+		if cqe.IsNotification() {
+			// The zero copy notification ends the request.
+			result.Flags |= CQEFNotif
+		} else {
+			result.Res = cqe.Res
+			result.Flags = cqe.Flags
+		}
+		if !cqe.More() && !c.done[index] {
+			c.done[index] = true
+			c.pending--
+		}
+	case chainKindTimeout:
+		c.results[index].TimedOut = cqe.Res == -int32(syscall.ETIME)
+		c.pending--
+	case chainKindCancel:
+		c.aborted[index] = cqe.Res == 0
+		c.pending--
+	}
+
+	return true
+}
+
+// Done reports whether all the completions of the chain were handled.
+func (c *Chain) Done() bool {
+	return c.submitted && c.pending <= 0
+}
+
+// Cancel requests cancellation of the links which have not completed yet.
+func (c *Chain) Cancel() error {
+	if !c.submitted || c.cancelled {
+		return nil
+	}
+	c.cancelled = true
+
+	var count int
+	for i := range c.links {
+		if !c.done[i] {
+			count++
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+
+	batch, err := c.ring.Reserve(uint32(count))
+	if err != nil {
+		return err
+	}
+	defer batch.Rollback()
+
+	entry := 0
+	for i := range c.links {
+		if c.done[i] {
+			continue
+		}
+		sqe := batch.Entry(entry)
+		entry++
+		sqe.PrepareCancel64(c.userData(chainKindLink, i), 0)
+		sqe.UserData = c.userData(chainKindCancel, i)
+	}
+
+	err = batch.Commit()
+	if err != nil {
+		return err
+	}
+	c.pending += count
+
+	_, err = c.ring.Submit()
+
+	return err
+}
+
+// Wait reaps completions until the chain is done and returns its result.
+// Completions which do not belong to the chain are passed to other, which
+// may be nil if nothing else is in flight on the ring. If a deadline was set
+// and passes, the pending links are cancelled.
+func (c *Chain) Wait(other func(cqe *CompletionQueueEvent)) (*ChainResult, error) {
+	if !c.submitted {
+		return nil, fmt.Errorf("chain not submitted: %w", syscall.EINVAL)
+	}
+
+	for !c.Done() {
+		var (
+			cqe *CompletionQueueEvent
+			err error
+		)
+
+		if !c.deadline.IsZero() && !c.cancelled {
+			remaining := time.Until(c.deadline)
+			if remaining <= 0 {
+				c.expired = true
+				err = c.Cancel()
+				if err != nil {
+					return nil, err
+				}
+
+				continue
+			}
+
+			ts := syscall.NsecToTimespec(remaining.Nanoseconds())
+			cqe, err = c.ring.WaitCQETimeout(&ts)
+			runtime.KeepAlive(ts)
+		} else {
+			cqe, err = c.ring.WaitCQE()
+		}
+
+		if err != nil {
+			if errors.Is(err, syscall.ETIME) || errors.Is(err, syscall.EINTR) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		if !c.Handle(cqe) && other != nil {
+			other(cqe)
+		}
+		c.ring.CQESeen(cqe)
+	}
+
+	return c.Result(), nil
+}
+
+// LinkResult is the completion of a single link.
+type LinkResult struct {
+	Res   int32
+	Flags uint32
+	// TimedOut is set if the link timeout of the link expired.
+	TimedOut bool
+}
+
+// ChainResult describes how a chain completed.
+type ChainResult struct {
+	Links []LinkResult
+	// Failed is the index of the first link which failed or broke the
+	// chain, or -1.
+	Failed int
+	// Completed lists the links which succeeded.
+	Completed []int
+	// Cancelled lists the links which were cancelled because an earlier
+	// link failed or the deadline passed.
+	Cancelled []int
+	// DeadlineExceeded is set if the chain deadline passed.
+	DeadlineExceeded bool
+
+	opCodes []uint8
+	ids     []uint64
+}
+
+// Result classifies the results of a chain which is done.
+func (c *Chain) Result() *ChainResult {
+	result := &ChainResult{
+		Links:            c.results,
+		Failed:           chainNoFailedLink,
+		DeadlineExceeded: c.expired,
+		opCodes:          make([]uint8, len(c.links)),
+		ids:              make([]uint64, len(c.links)),
+	}
+
+	broken := false
+	for i, link := range c.links {
+		result.opCodes[i] = link.opCode
+		result.ids[i] = c.userData(chainKindLink, i)
+
+		res := c.results[i].Res
+		// The next link completing with ECANCELED without being the target
+		// of Cancel means this one broke the chain.
+		nextCancelled := i+1 < len(c.links) && !c.aborted[i+1] &&
+			c.results[i+1].Res == -int32(syscall.ECANCELED)
+
+		switch {
+		case broken && res == -int32(syscall.ECANCELED):
+			result.Cancelled = append(result.Cancelled, i)
+		case res < 0:
+			if result.Failed == chainNoFailedLink {
+				result.Failed = i
+			}
+		case nextCancelled && !link.hard && result.Failed == chainNoFailedLink:
+			// A short read or write breaks the chain without an error.
+			result.Failed = i
+		default:
+			result.Completed = append(result.Completed, i)
+		}
+
+		failed := res < 0 || (nextCancelled && result.Failed == i)
+		broken = !link.hard && (failed || (broken && res == -int32(syscall.ECANCELED)))
+	}
+
+	return result
+}
+
+// Err returns the error of the failed link, or nil if the chain succeeded.
+// Deadline errors wrap syscall.ETIME and link errors are *CQEError values.
+func (r *ChainResult) Err() error {
+	if r.Failed == chainNoFailedLink {
+		return nil
+	}
+
+	link := r.Links[r.Failed]
+	switch {
+	case r.DeadlineExceeded:
+		return fmt.Errorf("chain deadline exceeded at link %d: %w", r.Failed, syscall.ETIME)
+	case link.Res >= 0:
+		return fmt.Errorf("link %d broke the chain with result %d: %w", r.Failed, link.Res, syscall.ECANCELED)
+	}
+
+	return (&CompletionQueueEvent{UserData: r.ids[r.Failed], Res: link.Res}).ErrWithOp(r.opCodes[r.Failed])
+}
@@ -0,0 +1,179 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func TestChainCompleted(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	chain := ring.NewChain()
+	for i := 0; i < 3; i++ {
+		chain.Add(func(sqe *SubmissionQueueEntry) { sqe.PrepareNop() })
+	}
+	Equal(t, 3, chain.Len())
+	NoError(t, chain.Submit())
+	ErrorIs(t, chain.Submit(), ErrChainSubmitted)
+
+	result, err := chain.Wait(nil)
+	NoError(t, err)
+	True(t, chain.Done())
+	NoError(t, result.Err())
+	Equal(t, -1, result.Failed)
+	Equal(t, []int{0, 1, 2}, result.Completed)
+	Empty(t, result.Cancelled)
+	Equal(t, uint32(0), ring.CQReady())
+}
+
+func TestChainFailedLink(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	buf := make([]byte, 8)
+	result, err := ring.NewChain().
+		Add(func(sqe *SubmissionQueueEntry) { sqe.PrepareNop() }).
+		Add(func(sqe *SubmissionQueueEntry) { sqe.PrepareRead(-1, uintptr(unsafe.Pointer(&buf[0])), 8, 0) }).
+		Add(func(sqe *SubmissionQueueEntry) { sqe.PrepareNop() }).
+		Add(func(sqe *SubmissionQueueEntry) { sqe.PrepareNop() }).
+		submitAndWait(t)
+	NoError(t, err)
+
+	Equal(t, 1, result.Failed)
+	Equal(t, []int{0}, result.Completed)
+	Equal(t, []int{2, 3}, result.Cancelled)
+
+	var cqeErr *CQEError
+	ErrorAs(t, result.Err(), &cqeErr)
+	ErrorIs(t, result.Err(), syscall.EBADF)
+	True(t, cqeErr.HasOpCode)
+	Equal(t, OpRead, cqeErr.OpCode)
+}
+
+func TestChainHardLink(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	buf := make([]byte, 8)
+	result, err := ring.NewChain().
+		AddHard(func(sqe *SubmissionQueueEntry) { sqe.PrepareRead(-1, uintptr(unsafe.Pointer(&buf[0])), 8, 0) }).
+		Add(func(sqe *SubmissionQueueEntry) { sqe.PrepareNop() }).
+		submitAndWait(t)
+	NoError(t, err)
+
+	Equal(t, 0, result.Failed)
+	Equal(t, []int{1}, result.Completed)
+	Empty(t, result.Cancelled)
+}
+
+func TestChainLinkTimeout(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	reader, writer, err := os.Pipe()
+	NoError(t, err)
+	defer reader.Close()
+	defer writer.Close()
+
+	buf := make([]byte, 8)
+	result, err := ring.NewChain().
+		Add(func(sqe *SubmissionQueueEntry) {
+			sqe.PrepareRead(int(reader.Fd()), uintptr(unsafe.Pointer(&buf[0])), 8, 0)
+		}).
+		LinkTimeout(10 * time.Millisecond).
+		Add(func(sqe *SubmissionQueueEntry) { sqe.PrepareNop() }).
+		submitAndWait(t)
+	NoError(t, err)
+
+	Equal(t, 0, result.Failed)
+	True(t, result.Links[0].TimedOut)
+	ErrorIs(t, result.Err(), syscall.ECANCELED)
+	Equal(t, []int{1}, result.Cancelled)
+}
+
+func TestChainDeadline(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	reader, writer, err := os.Pipe()
+	NoError(t, err)
+	defer reader.Close()
+	defer writer.Close()
+
+	buf := make([]byte, 8)
+	chain := ring.NewChain().
+		Add(func(sqe *SubmissionQueueEntry) { sqe.PrepareNop() }).
+		Add(func(sqe *SubmissionQueueEntry) {
+			sqe.PrepareRead(int(reader.Fd()), uintptr(unsafe.Pointer(&buf[0])), 8, 0)
+		}).
+		Add(func(sqe *SubmissionQueueEntry) { sqe.PrepareNop() }).
+		Deadline(time.Now().Add(20 * time.Millisecond))
+	NoError(t, chain.Submit())
+
+	// A request outside of the chain is handed to the callback.
+	sqe := ring.GetSQE()
+	sqe.PrepareNop()
+	sqe.UserData = 42
+	_, err = ring.Submit()
+	NoError(t, err)
+
+	var other []uint64
+	result, err := chain.Wait(func(cqe *CompletionQueueEvent) {
+		other = append(other, cqe.UserData)
+	})
+	NoError(t, err)
+
+	Equal(t, []uint64{42}, other)
+	True(t, result.DeadlineExceeded)
+	Equal(t, 1, result.Failed)
+	Equal(t, []int{0}, result.Completed)
+	Equal(t, []int{2}, result.Cancelled)
+	ErrorIs(t, result.Err(), syscall.ETIME)
+	Equal(t, uint32(0), ring.CQReady())
+}
+
+func (c *Chain) submitAndWait(t *testing.T) (*ChainResult, error) {
+	t.Helper()
+	NoError(t, c.Submit())
+
+	return c.Wait(nil)
+}
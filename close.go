@@ -0,0 +1,269 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultCloseTimeout is how long Close waits for cancelled requests to
+// complete.
+const DefaultCloseTimeout = time.Second
+
+// closeCancelUserData marks the cancel request submitted by Close on kernels
+// without synchronous cancellation.
+const closeCancelUserData = liburingUdataTimeout - 1
+
+// closeCancelInterval is how long Close waits for cancelled requests to
+// complete before looking for requests left in flight again.
+const closeCancelInterval = 10 * time.Millisecond
+
+// ErrRingClosed is returned when closing a ring which was already closed or
+// exited.
+var ErrRingClosed = errors.New("ring closed")
+
+// Close implements io.Closer. It is CloseTimeout with DefaultCloseTimeout.
+func (ring *Ring) Close() error {
+	return ring.CloseTimeout(DefaultCloseTimeout)
+}
+
+// CloseTimeout tears the ring down without leaving the kernel with requests
+// that reference Go memory. Unsubmitted SQEs are dropped, outstanding
+// requests are cancelled and their completions are drained for at most
+// timeout. Registered files, buffers and buffer rings set up with
+// SetupBufRing are unregistered before the rings are unmapped.
+//
+// If requests are still in flight when the timeout expires, the ring is
+// torn down anyway and an error wrapping syscall.ETIME is returned; memory
+// used by those requests must then be kept alive by the caller.
+func (ring *Ring) CloseTimeout(timeout time.Duration) error {
+	if ring.isExiting() {
+		return ErrRingClosed
+	}
+
+	sq := ring.sqRing
+	sq.sqeTail = sq.sqeHead
+	ring.batchOpen = false
+
+	err := ring.cancelInFlight(time.Now().Add(timeout))
+	ring.drainCQ()
+
+	ring.unregisterResources()
+	ring.QueueExit()
+
+	return err
+}
+
+func (ring *Ring) isExiting() bool {
+	attachMu.Lock()
+	defer attachMu.Unlock()
+
+	return ring.wqExiting
+}
+
+func (ring *Ring) drainCQ() {
+	if ring.cqRingNeedsFlush() || ring.flags&SetupDeferTaskrun != 0 {
+		_, _ = ring.GetEvents()
+	}
+	ring.CQAdvance(ring.CQReady())
+}
+
+func (ring *Ring) cancelInFlight(deadline time.Time) error {
+	caps, err := GetCapabilities()
+	if err != nil || caps.SupportsRegister(RegisterSyncCancel) != nil {
+		return ring.cancelInFlightAsync(deadline)
+	}
+
+	for {
+		ring.drainCQ()
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("requests still in flight on close: %w", syscall.ETIME)
+		}
+
+		cancelled, err := ring.RegisterSyncCancel(&SyncCancelReg{
+			Fd:      -1,
+			Flags:   AsyncCancelAny | AsyncCancelAll,
+			Timeout: syscall.NsecToTimespec(remaining.Nanoseconds()),
+		})
+
+		switch {
+		case err == nil && cancelled > 0:
+			continue
+		case err == nil, errors.Is(err, syscall.ENOENT):
+			return nil
+		case errors.Is(err, syscall.ETIME):
+			return fmt.Errorf("requests still in flight on close: %w", syscall.ETIME)
+		default:
+			return err
+		}
+	}
+}
+
+// cancelInFlightAsync cancels every request with an async cancel request
+// and repeats until the kernel finds nothing left to cancel. Requests which
+// are already running are found by a cancel request but only complete later,
+// so only an empty result proves that nothing is in flight.
+func (ring *Ring) cancelInFlightAsync(deadline time.Time) error {
+	for {
+		ring.drainCQ()
+
+		found, err := ring.cancelAllAsync(deadline)
+		if err != nil || found == 0 {
+			return err
+		}
+
+		// Give the cancelled requests a moment to complete.
+		wait := min(time.Until(deadline), closeCancelInterval)
+		if wait <= 0 {
+			return fmt.Errorf("requests still in flight on close: %w", syscall.ETIME)
+		}
+		ts := syscall.NsecToTimespec(wait.Nanoseconds())
+		cqe, err := ring.WaitCQETimeout(&ts)
+		runtime.KeepAlive(ts)
+		if err == nil {
+			ring.CQESeen(cqe)
+		} else if !errors.Is(err, syscall.ETIME) && !errors.Is(err, syscall.EINTR) {
+			return err
+		}
+	}
+}
+
+// cancelAllAsync submits a request cancelling every request and returns the
+// number it found. Other completions are discarded while waiting for its
+// result.
+func (ring *Ring) cancelAllAsync(deadline time.Time) (int32, error) {
+	sqe := ring.GetSQE()
+	if sqe == nil {
+		return 0, syscall.EBUSY
+	}
+	sqe.PrepareCancel64(0, int(AsyncCancelAny|AsyncCancelAll))
+	sqe.UserData = closeCancelUserData
+
+	_, err := ring.Submit()
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return 0, fmt.Errorf("requests still in flight on close: %w", syscall.ETIME)
+		}
+
+		ts := syscall.NsecToTimespec(remaining.Nanoseconds())
+		cqe, err := ring.WaitCQETimeout(&ts)
+		runtime.KeepAlive(ts)
+		if err != nil {
+			if errors.Is(err, syscall.ETIME) || errors.Is(err, syscall.EINTR) {
+				continue
+			}
+
+			return 0, err
+		}
+
+		userData, res := cqe.UserData, cqe.Res
+		ring.CQESeen(cqe)
+		if userData != closeCancelUserData {
+			continue
+		}
+
+		switch {
+		case res == -int32(syscall.ENOENT):
+			return 0, nil
+		case res < 0:
+			return 0, syscall.Errno(-res)
+		default:
+			return res, nil
+		}
+	}
+}
+
+func (ring *Ring) unregisterResources() {
+	_, _ = ring.UnregisterFiles()
+	_, _ = ring.UnregisterBuffers()
+
+	for bgid := range ring.bufRings {
+		_ = ring.FreeBufRing(int(bgid))
+	}
+}
+
+// LeakInfo describes a ring which was garbage collected without being
+// closed.
+type LeakInfo struct {
+	Fd        int
+	SQEntries uint32
+	CQEntries uint32
+	// Stack is the stack of the goroutine which set the ring up.
+	Stack []byte
+}
+
+var (
+	leakHandlerMu sync.RWMutex
+	leakHandler   func(LeakInfo)
+)
+
+// SetLeakHandler installs fn to be called for every ring which becomes
+// unreachable without QueueExit or Close being called. Only rings set up
+// after the call are tracked, and tracking records the setup stack, so it is
+// meant for tests and debugging. A nil fn disables the detector.
+func SetLeakHandler(fn func(LeakInfo)) {
+	leakHandlerMu.Lock()
+	defer leakHandlerMu.Unlock()
+
+	leakHandler = fn
+}
+
+func (ring *Ring) trackLeak() {
+	leakHandlerMu.RLock()
+	handler := leakHandler
+	leakHandlerMu.RUnlock()
+
+	if handler == nil {
+		return
+	}
+
+	stack := make([]byte, 4096)
+	stack = stack[:runtime.Stack(stack, false)]
+	info := LeakInfo{
+		Fd:        ring.ringFd,
+		SQEntries: ring.params.sqEntries,
+		CQEntries: ring.params.cqEntries,
+		Stack:     stack,
+	}
+
+	runtime.SetFinalizer(ring, func(*Ring) {
+		handler(info)
+	})
+}
+
+func (ring *Ring) untrackLeak() {
+	runtime.SetFinalizer(ring, nil)
+}
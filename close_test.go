@@ -0,0 +1,171 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"io"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func queuePipeRead(t *testing.T, ring *Ring, buf []byte) *os.File {
+	t.Helper()
+
+	reader, writer, err := os.Pipe()
+	NoError(t, err)
+	t.Cleanup(func() {
+		reader.Close()
+		writer.Close()
+	})
+
+	sqe := ring.GetSQE()
+	NotNil(t, sqe)
+	sqe.PrepareRead(int(reader.Fd()), uintptr(unsafe.Pointer(&buf[0])), uint32(len(buf)), 0)
+	sqe.UserData = 1
+	_, err = ring.Submit()
+	NoError(t, err)
+
+	return writer
+}
+
+func TestRingClose(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	var closer io.Closer = ring
+
+	buf := make([]byte, 64)
+	_, err = ring.RegisterBuffers([]syscall.Iovec{{Base: &buf[0], Len: uint64(len(buf))}})
+	NoError(t, err)
+	_, err = ring.RegisterFiles([]int{int(os.Stdin.Fd())})
+	NoError(t, err)
+	_, err = ring.SetupBufRing(8, 1, 0)
+	NoError(t, err)
+
+	readBuf := make([]byte, 64)
+	queuePipeRead(t, ring, readBuf)
+
+	// An unsubmitted SQE is dropped.
+	sqe := ring.GetSQE()
+	NotNil(t, sqe)
+	sqe.PrepareNop()
+
+	start := time.Now()
+	NoError(t, closer.Close())
+	Less(t, time.Since(start), DefaultCloseTimeout)
+	Empty(t, ring.bufRings)
+	runtime.KeepAlive(readBuf)
+
+	ErrorIs(t, ring.Close(), ErrRingClosed)
+	ring.QueueExit()
+}
+
+func TestRingCloseAsyncCancel(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	readBuf := make([]byte, 64)
+	queuePipeRead(t, ring, readBuf)
+	queuePipeRead(t, ring, readBuf)
+
+	NoError(t, ring.cancelInFlightAsync(time.Now().Add(time.Second)))
+	Equal(t, uint32(0), ring.CQReady())
+
+	// Nothing is left to cancel.
+	NoError(t, ring.cancelInFlightAsync(time.Now().Add(time.Second)))
+	runtime.KeepAlive(readBuf)
+}
+
+func TestRingCloseAsyncCancelRunning(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	// A read forced to io-wq blocks in a worker, where cancelling can only
+	// interrupt it. A NOP completes normally meanwhile.
+	readBuf := make([]byte, 64)
+	reader, writer, err := os.Pipe()
+	NoError(t, err)
+	defer reader.Close()
+	defer writer.Close()
+
+	sqe := ring.GetSQE()
+	sqe.PrepareRead(int(reader.Fd()), uintptr(unsafe.Pointer(&readBuf[0])), uint32(len(readBuf)), 0)
+	sqe.Flags |= SqeAsync
+	sqe.UserData = 1
+	queuePipeRead(t, ring, readBuf)
+	ring.GetSQE().PrepareNop()
+
+	NoError(t, ring.cancelInFlightAsync(time.Now().Add(time.Second)))
+
+	found, err := ring.cancelAllAsync(time.Now().Add(time.Second))
+	NoError(t, err)
+	Zero(t, found)
+	runtime.KeepAlive(readBuf)
+}
+
+func TestLeakHandler(t *testing.T) {
+	leaks := make(chan LeakInfo, 1)
+	SetLeakHandler(func(info LeakInfo) {
+		leaks <- info
+	})
+	defer SetLeakHandler(nil)
+
+	closed, err := CreateRing(4)
+	NoError(t, err)
+	NoError(t, closed.Close())
+
+	fd := func() int {
+		ring, err := CreateRing(4)
+		NoError(t, err)
+
+		return ring.RingFd()
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		runtime.GC()
+		select {
+		case info := <-leaks:
+			Equal(t, fd, info.Fd)
+			Equal(t, uint32(4), info.SQEntries)
+			Contains(t, string(info.Stack), "TestLeakHandler")
+			syscall.Close(info.Fd)
+
+			return
+		case <-deadline:
+			t.Fatal("leaked ring was not reported")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
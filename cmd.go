@@ -0,0 +1,79 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	sqeCmdOffset = unsafe.Offsetof(SubmissionQueueEntry{}.Addr3)
+	sqeSize64    = unsafe.Sizeof(SubmissionQueueEntry{})
+)
+
+// Cmd returns the command area of an SQE handed out by this ring: 16 bytes,
+// or 80 bytes on rings set up with SetupSQE128. It returns nil for SQEs
+// which do not belong to the ring. The area overlaps Addr3.
+func (ring *Ring) Cmd(sqe *SubmissionQueueEntry) []byte {
+	if sqe == nil || ring.sqRing.sqes == nil {
+		return nil
+	}
+
+	size := sqeSize64
+	if ring.flags&SetupSQE128 != 0 {
+		size *= 2
+	}
+	start := uintptr(unsafe.Pointer(ring.sqRing.sqes))
+	ptr := uintptr(unsafe.Pointer(sqe))
+	if ptr < start || ptr >= start+uintptr(*ring.sqRing.ringEntries)*size || (ptr-start)%size != 0 {
+		return nil
+	}
+
+	return unsafe.Slice((*byte)(unsafe.Add(unsafe.Pointer(sqe), sqeCmdOffset)), size-sqeCmdOffset)
+}
+
+// PrepareUringCmd prepares a passthrough command cmdOp to the character
+// device or socket fd. The payload is copied to the command area of sqe and
+// the rest of the area is zeroed. Payloads larger than 16 bytes need a ring
+// set up with SetupSQE128.
+func (ring *Ring) PrepareUringCmd(sqe *SubmissionQueueEntry, cmdOp uint32, fd int, payload []byte) error {
+	cmd := ring.Cmd(sqe)
+	if cmd == nil {
+		return fmt.Errorf("SQE does not belong to the ring: %w", syscall.EINVAL)
+	}
+	if len(payload) > len(cmd) {
+		return fmt.Errorf("command payload of %d bytes exceeds %d bytes: %w", len(payload), len(cmd), syscall.EINVAL)
+	}
+
+	sqe.prepareRW(OpUringCmd, fd, 0, 0, 0)
+	sqe.Off = uint64(cmdOp)
+	copy(cmd, payload)
+	for i := len(payload); i < len(cmd); i++ {
+		cmd[i] = 0
+	}
+
+	return nil
+}
@@ -0,0 +1,419 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"unsafe"
+
+	"github.com/pawelgaczynski/giouring"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	ringEntries       = 4
+	ioUringDisabledFn = "/proc/sys/kernel/io_uring_disabled"
+)
+
+type opReport struct {
+	Code      uint8  `json:"code"`
+	Name      string `json:"name"`
+	Supported bool   `json:"supported"`
+}
+
+type flagReport struct {
+	Name    string `json:"name"`
+	Value   uint32 `json:"value"`
+	Enabled bool   `json:"enabled"`
+}
+
+type registerReport struct {
+	Code  uint32 `json:"code"`
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+type limitReport struct {
+	Name  string `json:"name"`
+	Soft  string `json:"soft"`
+	Hard  string `json:"hard,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type report struct {
+	Kernel     string           `json:"kernel"`
+	OpCodes    []opReport       `json:"opcodes"`
+	Features   []flagReport     `json:"features"`
+	SetupFlags []flagReport     `json:"setup_flags"`
+	Register   []registerReport `json:"register"`
+	Limits     []limitReport    `json:"limits"`
+}
+
+type registerCheck struct {
+	op    uint32
+	flags uint32
+	run   func(ring *giouring.Ring) error
+}
+
+var registerChecks = []registerCheck{
+	{op: giouring.RegisterBuffers, run: func(ring *giouring.Ring) error {
+		buf := make([]byte, os.Getpagesize())
+		_, err := ring.RegisterBuffers([]syscall.Iovec{{Base: &buf[0], Len: uint64(len(buf))}})
+
+		return err
+	}},
+	{op: giouring.RegisterFiles, run: func(ring *giouring.Ring) error {
+		_, err := ring.RegisterFiles([]int{int(os.Stdin.Fd())})
+
+		return err
+	}},
+	{op: giouring.RegisterEventFD, run: func(ring *giouring.Ring) error {
+		return withEventFd(func(fd int) error {
+			_, err := ring.RegisterEventFd(fd)
+
+			return err
+		})
+	}},
+	{op: giouring.RegisterFilesUpdate, run: func(ring *giouring.Ring) error {
+		_, err := ring.RegisterFilesSparse(1)
+		if err != nil {
+			return err
+		}
+		_, err = ring.RegisterFilesUpdate(0, []int{int(os.Stdin.Fd())})
+
+		return err
+	}},
+	{op: giouring.RegisterEventFDAsync, run: func(ring *giouring.Ring) error {
+		return withEventFd(func(fd int) error {
+			_, err := ring.RegisterEventFdAsync(fd)
+
+			return err
+		})
+	}},
+	{op: giouring.RegisterProbe, run: func(ring *giouring.Ring) error {
+		_, err := ring.GetProbeRing()
+
+		return err
+	}},
+	{op: giouring.RegisterPersonality, run: func(ring *giouring.Ring) error {
+		_, err := ring.RegisterPersonality()
+
+		return err
+	}},
+	{op: giouring.RegisterRestrictions, flags: giouring.SetupRDisabled, run: func(ring *giouring.Ring) error {
+		_, err := ring.RegisterRestrictions([]giouring.Restriction{{
+			OpCode:  uint16(giouring.RestrictionSQEOp),
+			OpFlags: giouring.OpNop,
+		}})
+
+		return err
+	}},
+	{op: giouring.RegisterEnableRings, flags: giouring.SetupRDisabled, run: func(ring *giouring.Ring) error {
+		_, err := ring.EnableRings()
+
+		return err
+	}},
+	{op: giouring.RegisterFiles2, run: func(ring *giouring.Ring) error {
+		_, err := ring.RegisterFilesSparse(1)
+
+		return err
+	}},
+	{op: giouring.RegisterBuffers2, run: func(ring *giouring.Ring) error {
+		_, err := ring.RegisterBuffersSparse(1)
+
+		return err
+	}},
+	{op: giouring.RegisterIOWQAff, run: func(ring *giouring.Ring) error {
+		var set unix.CPUSet
+		if err := unix.SchedGetaffinity(0, &set); err != nil {
+			return err
+		}
+
+		return ring.RegisterIOWQAff(uint64(unsafe.Sizeof(set)), &set)
+	}},
+	{op: giouring.RegisterIOWQMaxWorkers, run: func(ring *giouring.Ring) error {
+		_, err := ring.RegisterIOWQMaxWorkers([]uint{0, 0})
+
+		return err
+	}},
+	{op: giouring.RegisterRingFDs, run: func(ring *giouring.Ring) error {
+		_, err := ring.RegisterRingFd()
+		if err != nil {
+			return err
+		}
+		_, err = ring.UnregisterRingFd()
+
+		return err
+	}},
+	{op: giouring.RegisterPbufRing, run: func(ring *giouring.Ring) error {
+		_, err := ring.SetupBufRing(ringEntries, 0, 0)
+
+		return err
+	}},
+	{op: giouring.RegisterSyncCancel, run: func(ring *giouring.Ring) error {
+		_, err := ring.RegisterSyncCancel(&giouring.SyncCancelReg{
+			Fd:      -1,
+			Timeout: syscall.Timespec{Sec: -1, Nsec: -1},
+		})
+		// Nothing is in flight, so a kernel which knows the opcode reports
+		// that no matching request was found.
+		if errors.Is(err, syscall.ENOENT) {
+			return nil
+		}
+
+		return err
+	}},
+	{op: giouring.RegisterFileAllocRange, run: func(ring *giouring.Ring) error {
+		_, err := ring.RegisterFilesSparse(1)
+		if err != nil {
+			return err
+		}
+		_, err = ring.RegisterFileAllocRange(0, 1)
+
+		return err
+	}},
+}
+
+func withEventFd(fn func(fd int) error) error {
+	fd, err := unix.Eventfd(0, unix.EFD_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	return fn(fd)
+}
+
+func checkRegister(check registerCheck) registerReport {
+	result := registerReport{
+		Code: check.op,
+		Name: giouring.RegisterOpName(check.op),
+	}
+
+	ring := giouring.NewRing()
+	if err := ring.QueueInit(ringEntries, check.flags); err != nil {
+		result.Error = err.Error()
+
+		return result
+	}
+	defer ring.QueueExit()
+
+	if err := check.run(ring); err != nil {
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// flagReports lists every known flag bit together with any unknown bit set in
+// value.
+func flagReports(value uint32, name func(bit uint32) string) []flagReport {
+	var reports []flagReport
+	for bit := 0; bit < 32; bit++ {
+		flagValue := uint32(1) << bit
+		flagName := name(flagValue)
+		enabled := value&flagValue != 0
+		if strings.HasPrefix(flagName, "0x") && !enabled {
+			continue
+		}
+		reports = append(reports, flagReport{
+			Name:    flagName,
+			Value:   flagValue,
+			Enabled: enabled,
+		})
+	}
+
+	return reports
+}
+
+func rlimit(name string, resource int) limitReport {
+	result := limitReport{Name: name}
+
+	var lim unix.Rlimit
+	if err := unix.Getrlimit(resource, &lim); err != nil {
+		result.Error = err.Error()
+
+		return result
+	}
+	result.Soft = rlimitValue(lim.Cur)
+	result.Hard = rlimitValue(lim.Max)
+
+	return result
+}
+
+func rlimitValue(value uint64) string {
+	if value == unix.RLIM_INFINITY {
+		return "unlimited"
+	}
+
+	return strconv.FormatUint(value, 10)
+}
+
+func ioUringDisabled() limitReport {
+	result := limitReport{Name: "kernel.io_uring_disabled"}
+
+	data, err := os.ReadFile(ioUringDisabledFn)
+	if err != nil {
+		// The sysctl is only present since Linux 6.6.
+		if errors.Is(err, os.ErrNotExist) {
+			result.Soft = "n/a"
+		} else {
+			result.Error = err.Error()
+		}
+
+		return result
+	}
+	result.Soft = strings.TrimSpace(string(data))
+
+	return result
+}
+
+func collect() (*report, error) {
+	kernel, err := giouring.GetKernelVersion()
+	if err != nil {
+		return nil, fmt.Errorf("kernel version: %w", err)
+	}
+
+	probe, err := giouring.GetProbe()
+	if err != nil {
+		return nil, fmt.Errorf("probe: %w", err)
+	}
+
+	caps, err := giouring.GetCapabilities()
+	if err != nil {
+		return nil, fmt.Errorf("capabilities: %w", err)
+	}
+
+	result := &report{
+		Kernel: fmt.Sprintf("%d.%d.%d%s", kernel.Kernel, kernel.Major, kernel.Minor, kernel.Flavor),
+	}
+
+	for op := uint8(0); op <= probe.LastOp; op++ {
+		result.OpCodes = append(result.OpCodes, opReport{
+			Code:      op,
+			Name:      giouring.OpCodeName(op),
+			Supported: probe.IsSupported(op),
+		})
+	}
+
+	result.Features = flagReports(uint32(caps.Features), func(bit uint32) string {
+		return giouring.FeatureSet(bit).String()
+	})
+	result.SetupFlags = flagReports(uint32(caps.SetupFlags), func(bit uint32) string {
+		return giouring.SetupFlags(bit).String()
+	})
+
+	for _, check := range registerChecks {
+		result.Register = append(result.Register, checkRegister(check))
+	}
+
+	result.Limits = []limitReport{
+		rlimit("RLIMIT_MEMLOCK", unix.RLIMIT_MEMLOCK),
+		rlimit("RLIMIT_NOFILE", unix.RLIMIT_NOFILE),
+		ioUringDisabled(),
+	}
+
+	return result, nil
+}
+
+func printTable(result *report) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "kernel\t%s\n\n", result.Kernel)
+
+	fmt.Fprintln(w, "OPCODE\tNAME\tSUPPORTED")
+	for _, op := range result.OpCodes {
+		fmt.Fprintf(w, "%d\t%s\t%s\n", op.Code, op.Name, yesNo(op.Supported))
+	}
+
+	fmt.Fprintln(w, "\nFEATURE\tVALUE\tPRESENT")
+	for _, feature := range result.Features {
+		fmt.Fprintf(w, "%s\t%#x\t%s\n", feature.Name, feature.Value, yesNo(feature.Enabled))
+	}
+
+	fmt.Fprintln(w, "\nSETUP FLAG\tVALUE\tALLOWED")
+	for _, setupFlag := range result.SetupFlags {
+		fmt.Fprintf(w, "%s\t%#x\t%s\n", setupFlag.Name, setupFlag.Value, yesNo(setupFlag.Enabled))
+	}
+
+	fmt.Fprintln(w, "\nREGISTER OP\tNAME\tRESULT")
+	for _, reg := range result.Register {
+		status := "ok"
+		if reg.Error != "" {
+			status = reg.Error
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", reg.Code, reg.Name, status)
+	}
+
+	fmt.Fprintln(w, "\nLIMIT\tSOFT\tHARD")
+	for _, limit := range result.Limits {
+		if limit.Error != "" {
+			fmt.Fprintf(w, "%s\t%s\t\n", limit.Name, limit.Error)
+
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", limit.Name, limit.Soft, limit.Hard)
+	}
+
+	return w.Flush()
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+
+	return "no"
+}
+
+func main() {
+	jsonOutput := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	result, err := collect()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(result)
+	} else {
+		err = printTable(result)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
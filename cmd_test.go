@@ -0,0 +1,131 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"encoding/binary"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func TestCmd(t *testing.T) {
+	ring, err := CreateRing(4)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	sqe := ring.GetSQE()
+	Len(t, ring.Cmd(sqe), 16)
+	Nil(t, ring.Cmd(&SubmissionQueueEntry{}))
+
+	NoError(t, ring.PrepareUringCmd(sqe, 7, 3, []byte{1, 2, 3, 4, 5, 6, 7, 8}))
+	Equal(t, OpUringCmd, sqe.OpCode)
+	Equal(t, uint64(7), sqe.Off)
+	Equal(t, int32(3), sqe.Fd)
+	Equal(t, uint64(0x0807060504030201), sqe.Addr3)
+	ErrorIs(t, ring.PrepareUringCmd(sqe, 7, 3, make([]byte, 17)), syscall.EINVAL)
+
+	big := NewRing()
+	NoError(t, big.QueueInit(4, SetupSQE128))
+
+	defer big.QueueExit()
+
+	first := big.GetSQE()
+	second := big.GetSQE()
+	Len(t, big.Cmd(first), 80)
+	Equal(t, uintptr(128), uintptr(unsafe.Pointer(second))-uintptr(unsafe.Pointer(first)))
+
+	payload := make([]byte, 80)
+	for i := range payload {
+		payload[i] = byte(i + 1)
+	}
+	NoError(t, big.PrepareUringCmd(first, 1, 0, payload))
+	Equal(t, payload, big.Cmd(first))
+	Equal(t, binary.LittleEndian.Uint64(payload), first.Addr3)
+
+	NoError(t, big.PrepareUringCmd(first, 1, 0, nil))
+	Equal(t, make([]byte, 80), big.Cmd(first))
+}
+
+func udpSocket(t *testing.T) int {
+	t.Helper()
+
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, 0)
+	NoError(t, err)
+	t.Cleanup(func() { syscall.Close(fd) })
+	NoError(t, syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}))
+
+	return fd
+}
+
+func TestPrepareUringCmdSocket(t *testing.T) {
+	ring, err := CreateRing(4)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	fd := udpSocket(t)
+	addr, err := syscall.Getsockname(fd)
+	NoError(t, err)
+	NoError(t, syscall.Sendto(fd, make([]byte, 10), 0, addr))
+
+	sqe := ring.GetSQE()
+	NoError(t, ring.PrepareUringCmd(sqe, SocketUringOpSiocinq, fd, nil))
+	_, err = ring.SubmitAndWait(1)
+	NoError(t, err)
+
+	cqe, err := ring.WaitCQE()
+	NoError(t, err)
+	NoError(t, cqe.ErrWithOp(OpUringCmd))
+	Equal(t, int32(10), cqe.Res)
+	ring.CQESeen(cqe)
+}
+
+func TestPrepareCmdSockGetsockopt(t *testing.T) {
+	ring, err := CreateRing(4)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	fd := udpSocket(t)
+
+	var value int32
+	sqe := ring.GetSQE()
+	sqe.PrepareCmdSock(SocketUringOpGetsockopt, fd, syscall.SOL_SOCKET, syscall.SO_TYPE,
+		unsafe.Pointer(&value), int(unsafe.Sizeof(value)))
+	_, err = ring.SubmitAndWait(1)
+	NoError(t, err)
+
+	cqe, err := ring.WaitCQE()
+	NoError(t, err)
+	if cqe.Res == -int32(syscall.EOPNOTSUPP) || cqe.Res == -int32(syscall.EINVAL) {
+		t.Skip("SOCKET_URING_OP_GETSOCKOPT is not supported by this kernel")
+	}
+	NoError(t, cqe.ErrWithOp(OpUringCmd))
+	Equal(t, int32(syscall.SOCK_DGRAM), value)
+	ring.CQESeen(cqe)
+}
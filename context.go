@@ -0,0 +1,285 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// User data of the internal completions used by context aware waits. The
+// reaping functions (PeekCQE, WaitCQE, PeekBatchCQE, ForEachCQE and the
+// Completions iterator) consume them when they reach them and never return
+// them to the caller, like the deliveries of mailboxes. CQReady counts them
+// until then.
+const (
+	ctxWakeUserData   = liburingUdataTimeout - 2
+	ctxCancelUserData = liburingUdataTimeout - 3
+)
+
+// ctxWaker holds the state of the context aware waits of a ring.
+type ctxWaker struct {
+	cancel bool
+}
+
+// SetCancelOnContextDone sets whether SubmitAndWaitContext cancels the
+// requests it submitted when its context is done. Requests are cancelled by
+// user data, so requests sharing the same user data are cancelled as well.
+func (ring *Ring) SetCancelOnContextDone(enabled bool) error {
+	waker, err := ring.contextWaker()
+	if err != nil {
+		return err
+	}
+	waker.cancel = enabled
+
+	return nil
+}
+
+// WaitCQEContext is WaitCQE which returns ctx.Err() when ctx is done before
+// a completion arrives. The waiter is woken up by a message posted to the
+// ring with OpMsgRing from another ring, so nothing is submitted to this
+// ring for it. It requires Linux 5.18 and a ring with a file descriptor.
+func (ring *Ring) WaitCQEContext(ctx context.Context) (*CompletionQueueEvent, error) {
+	for {
+		cqe, err := internalPeekCQE(ring, nil)
+		if err != nil || cqe != nil {
+			return cqe, err
+		}
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		_, err = ring.enterContext(ctx, false, 1)
+		if err != nil && !errors.Is(err, syscall.EINTR) {
+			return nil, err
+		}
+	}
+}
+
+// SubmitAndWaitContext is SubmitAndWait which returns ctx.Err() when ctx is
+// done before waitNr completions are available. The number of submitted
+// entries is returned in both cases. It is woken up like WaitCQEContext and
+// internal completions do not count towards waitNr.
+func (ring *Ring) SubmitAndWaitContext(ctx context.Context, waitNr uint32) (uint, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	var userData []uint64
+	if ring.ctxWake != nil && ring.ctxWake.cancel {
+		userData = ring.pendingUserData()
+	}
+
+	_, internal := ring.contextCQReady()
+	submitted, err := ring.enterContext(ctx, true, waitNr+internal)
+	for err == nil || errors.Is(err, syscall.EINTR) {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		var ready uint32
+		if ready, internal = ring.contextCQReady(); ready >= waitNr {
+			return submitted, nil
+		}
+
+		_, err = ring.enterContext(ctx, false, waitNr+internal)
+	}
+
+	if ctx.Err() != nil && len(userData) > 0 {
+		if cancelErr := ring.cancelUserData(userData); cancelErr != nil {
+			return submitted, errors.Join(err, cancelErr)
+		}
+	}
+
+	return submitted, err
+}
+
+// enterContext enters the kernel to wait for waitNr completions. When ctx is
+// done first, a wake up completion is posted to the ring, and consumed
+// before returning if nothing precedes it in the completion queue.
+func (ring *Ring) enterContext(ctx context.Context, submit bool, waitNr uint32) (uint, error) {
+	var toSubmit uint32
+	if submit {
+		toSubmit = ring.internalFlushSQ()
+	}
+
+	if ctx.Done() == nil {
+		return ring.internalSubmit(toSubmit, waitNr, false)
+	}
+
+	if _, err := ring.contextWaker(); err != nil {
+		return 0, err
+	}
+
+	woken := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		defer close(woken)
+		_ = postContextWake(ring.ringFd)
+	})
+
+	submitted, err := ring.internalSubmit(toSubmit, waitNr, true)
+
+	if !stop() {
+		<-woken
+		if ring.flags&SetupDeferTaskrun != 0 {
+			_, _ = ring.GetEvents()
+		}
+		ring.skipInternalCQEs()
+	}
+
+	return submitted, err
+}
+
+func (ring *Ring) contextWaker() (*ctxWaker, error) {
+	if ring.ctxWake != nil {
+		return ring.ctxWake, nil
+	}
+
+	if ring.ringFd < 0 {
+		return nil, fmt.Errorf("context aware waits need the ring file descriptor: %w", syscall.EBADF)
+	}
+	if err := openContextWakeRing(); err != nil {
+		return nil, err
+	}
+	ring.ctxWake = &ctxWaker{}
+
+	return ring.ctxWake, nil
+}
+
+func (ring *Ring) closeContextWaker() {
+	ring.ctxWake = nil
+}
+
+// contextWakeRing posts the wake up messages of all the rings. It is shared
+// by the process and only used with contextWakeMu held.
+var (
+	contextWakeMu      sync.Mutex
+	contextWakeRing    *Ring
+	contextWakeRingErr error
+)
+
+const contextWakeEntries = 8
+
+func openContextWakeRing() error {
+	contextWakeMu.Lock()
+	defer contextWakeMu.Unlock()
+
+	if contextWakeRing != nil || contextWakeRingErr != nil {
+		return contextWakeRingErr
+	}
+
+	caps, err := GetCapabilities()
+	if err == nil {
+		err = caps.Supports(OpMsgRing)
+	}
+	if err == nil {
+		contextWakeRing, err = CreateRing(contextWakeEntries)
+	}
+	contextWakeRingErr = err
+
+	return err
+}
+
+// postContextWake posts a completion with ctxWakeUserData to the ring with
+// the given file descriptor, waking up a waiter blocked in io_uring_enter.
+func postContextWake(ringFd int) error {
+	contextWakeMu.Lock()
+	defer contextWakeMu.Unlock()
+
+	ring := contextWakeRing
+	// Only failed messages post completions.
+	ring.CQAdvance(ring.CQReady())
+
+	sqe := ring.GetSQE()
+	if sqe == nil {
+		return syscall.EBUSY
+	}
+	sqe.PrepareMsgRing(ringFd, 0, ctxWakeUserData, 0)
+	sqe.Flags |= SqeCQESkipSuccess
+
+	_, err := ring.Submit()
+
+	return err
+}
+
+// contextCQReady returns the number of completions in the completion queue
+// which are not internal, and the number of internal ones.
+func (ring *Ring) contextCQReady() (uint32, uint32) {
+	head := *ring.cqRing.head
+	tail := atomic.LoadUint32(ring.cqRing.tail)
+	if !ring.hasInternalCQEs() {
+		return tail - head, 0
+	}
+
+	var internal uint32
+	for pos := head; pos != tail; pos++ {
+		if ring.isInternalCQE(ring.cqeAt(pos)) {
+			internal++
+		}
+	}
+
+	return tail - head - internal, internal
+}
+
+// pendingUserData returns the distinct user data of the SQEs which were
+// prepared but not submitted yet.
+func (ring *Ring) pendingUserData() []uint64 {
+	sq := ring.sqRing
+	seen := make(map[uint64]struct{})
+	userData := make([]uint64, 0, sq.sqeTail-sq.sqeHead)
+
+	for tail := sq.sqeHead; tail != sq.sqeTail; tail++ {
+		data := ring.sqeAt(tail).UserData
+		if _, ok := seen[data]; ok {
+			continue
+		}
+		seen[data] = struct{}{}
+		userData = append(userData, data)
+	}
+
+	return userData
+}
+
+func (ring *Ring) cancelUserData(userData []uint64) error {
+	for _, data := range userData {
+		sqe := ring.GetSQE()
+		if sqe == nil {
+			if _, err := ring.Submit(); err != nil {
+				return err
+			}
+			if sqe = ring.GetSQE(); sqe == nil {
+				return syscall.EBUSY
+			}
+		}
+		sqe.PrepareCancel64(data, int(AsyncCancelAll))
+		sqe.UserData = ctxCancelUserData
+	}
+
+	_, err := ring.Submit()
+
+	return err
+}
@@ -0,0 +1,275 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func TestWaitCQEContext(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	reader, writer, err := os.Pipe()
+	NoError(t, err)
+	defer reader.Close()
+	defer writer.Close()
+
+	buf := make([]byte, 8)
+	sqe := ring.GetSQE()
+	sqe.PrepareRead(int(reader.Fd()), uintptr(unsafe.Pointer(&buf[0])), uint32(len(buf)), 0)
+	sqe.UserData = 1
+	_, err = ring.Submit()
+	NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	cqe, err := ring.WaitCQEContext(ctx)
+	ErrorIs(t, err, context.DeadlineExceeded)
+	Nil(t, cqe)
+	Less(t, time.Since(start), time.Second)
+	Equal(t, uint32(0), ring.CQReady())
+
+	_, err = writer.Write([]byte("ping"))
+	NoError(t, err)
+
+	cqe, err = ring.WaitCQEContext(context.Background())
+	NoError(t, err)
+	Equal(t, uint64(1), cqe.UserData)
+	Equal(t, int32(4), cqe.Res)
+	ring.CQESeen(cqe)
+
+	// Nothing is left behind by the interrupted wait.
+	sqe = ring.GetSQE()
+	sqe.PrepareNop()
+	sqe.UserData = 2
+	_, err = ring.Submit()
+	NoError(t, err)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	cqe, err = ring.WaitCQEContext(ctx)
+	NoError(t, err)
+	Equal(t, uint64(2), cqe.UserData)
+	ring.CQESeen(cqe)
+
+	cancel()
+	_, err = ring.WaitCQEContext(ctx)
+	ErrorIs(t, err, context.Canceled)
+}
+
+func TestSubmitAndWaitContext(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	for i := 0; i < 2; i++ {
+		ring.GetSQE().PrepareNop()
+	}
+	submitted, err := ring.SubmitAndWaitContext(context.Background(), 2)
+	NoError(t, err)
+	Equal(t, uint(2), submitted)
+	Equal(t, uint32(2), ring.CQReady())
+	ring.CQAdvance(2)
+
+	reader, writer, err := os.Pipe()
+	NoError(t, err)
+	defer reader.Close()
+	defer writer.Close()
+
+	NoError(t, ring.SetCancelOnContextDone(true))
+
+	buf := make([]byte, 8)
+	sqe := ring.GetSQE()
+	sqe.PrepareRead(int(reader.Fd()), uintptr(unsafe.Pointer(&buf[0])), uint32(len(buf)), 0)
+	sqe.UserData = 7
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	submitted, err = ring.SubmitAndWaitContext(ctx, 1)
+	ErrorIs(t, err, context.Canceled)
+	Equal(t, uint(1), submitted)
+
+	cqe, err := ring.WaitCQE()
+	NoError(t, err)
+	Equal(t, uint64(7), cqe.UserData)
+	ErrorIs(t, cqe.Err(), syscall.ECANCELED)
+	ring.CQESeen(cqe)
+
+	_, err = ring.SubmitAndWaitContext(ctx, 1)
+	ErrorIs(t, err, context.Canceled)
+}
+
+func TestContextWaitLeavesNoInternalCQEs(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	reader, writer, err := os.Pipe()
+	NoError(t, err)
+	defer reader.Close()
+	defer writer.Close()
+
+	buf := make([]byte, 8)
+	sqe := ring.GetSQE()
+	sqe.PrepareRead(int(reader.Fd()), uintptr(unsafe.Pointer(&buf[0])), uint32(len(buf)), 0)
+	sqe.UserData = 1
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	submitted, err := ring.SubmitAndWaitContext(ctx, 1)
+	ErrorIs(t, err, context.DeadlineExceeded)
+	Equal(t, uint(1), submitted)
+	_, _ = ring.GetEvents()
+
+	Equal(t, uint32(0), ring.CQReady())
+	cqes := make([]*CompletionQueueEvent, 4)
+	Equal(t, uint32(0), ring.PeekBatchCQE(cqes))
+	ring.ForEachCQE(func(cqe *CompletionQueueEvent) {
+		Fail(t, "unexpected completion", "user data %#x", cqe.UserData)
+	})
+
+	// The wake poll is gone, so a drain request completes once the read does.
+	sqe = ring.GetSQE()
+	sqe.PrepareNop()
+	sqe.Flags |= SqeIODrain
+	sqe.UserData = 2
+
+	time.AfterFunc(20*time.Millisecond, func() {
+		_, _ = writer.Write([]byte("giouring"))
+	})
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	submitted, err = ring.SubmitAndWaitContext(ctx, 2)
+	NoError(t, err)
+	Equal(t, uint(1), submitted)
+	GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+	Equal(t, uint32(2), ring.CQReady())
+
+	Equal(t, uint32(2), ring.PeekBatchCQE(cqes))
+	results := make(map[uint64]int32)
+	for _, cqe := range cqes[:2] {
+		results[cqe.UserData] = cqe.Res
+	}
+	Equal(t, map[uint64]int32{1: int32(len(buf)), 2: 0}, results)
+	ring.CQAdvance(2)
+	Equal(t, uint32(0), ring.CQReady())
+}
+
+func TestSubmitAndWaitContextLinkAndDrain(t *testing.T) {
+	for _, flag := range []uint8{SqeIOLink, SqeIODrain} {
+		ring, err := CreateRing(8)
+		NoError(t, err)
+
+		reader, writer, err := os.Pipe()
+		NoError(t, err)
+
+		// A read which never completes, followed by a request that either
+		// ends with a dangling link or has to wait for the read to drain.
+		buf := make([]byte, 8)
+		sqe := ring.GetSQE()
+		sqe.PrepareRead(int(reader.Fd()), uintptr(unsafe.Pointer(&buf[0])), uint32(len(buf)), 0)
+		sqe.UserData = 1
+		sqe = ring.GetSQE()
+		if flag == SqeIOLink {
+			sqe.PrepareRead(int(reader.Fd()), uintptr(unsafe.Pointer(&buf[0])), uint32(len(buf)), 0)
+		} else {
+			sqe.PrepareNop()
+		}
+		sqe.Flags |= flag
+		sqe.UserData = 2
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		start := time.Now()
+		submitted, err := ring.SubmitAndWaitContext(ctx, 1)
+		cancel()
+		ErrorIs(t, err, context.DeadlineExceeded)
+		Equal(t, uint(2), submitted)
+		Less(t, time.Since(start), time.Second)
+
+		ring.QueueExit()
+		reader.Close()
+		writer.Close()
+	}
+}
+
+func TestContextWakeBehindCompletion(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	reader, writer, err := os.Pipe()
+	NoError(t, err)
+	defer reader.Close()
+	defer writer.Close()
+
+	buf := make([]byte, 8)
+	sqe := ring.GetSQE()
+	sqe.PrepareRead(int(reader.Fd()), uintptr(unsafe.Pointer(&buf[0])), uint32(len(buf)), 0)
+	sqe.UserData = 1
+	sqe = ring.GetSQE()
+	sqe.PrepareNop()
+	sqe.UserData = 2
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err = ring.SubmitAndWaitContext(ctx, 2)
+	ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The wake up completion follows the NOP; batches end before it.
+	Equal(t, uint32(2), ring.CQReady())
+	cqes := make([]*CompletionQueueEvent, 4)
+	Equal(t, uint32(1), ring.PeekBatchCQE(cqes))
+	Equal(t, uint64(2), cqes[0].UserData)
+
+	var seen []uint64
+	ring.ForEachCQE(func(cqe *CompletionQueueEvent) {
+		seen = append(seen, cqe.UserData)
+	})
+	Equal(t, []uint64{2}, seen)
+	ring.CQAdvance(1)
+
+	Equal(t, uint32(0), ring.PeekBatchCQE(cqes))
+	Equal(t, uint32(0), ring.CQReady())
+}
@@ -0,0 +1,138 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// CQEError is the error of a completion with a negative result.
+type CQEError struct {
+	UserData uint64
+	Errno    syscall.Errno
+	// OpCode is the Op* opcode of the request, valid only if HasOpCode is
+	// set.
+	OpCode    uint8
+	HasOpCode bool
+}
+
+func (e *CQEError) Error() string {
+	if e.HasOpCode {
+		return fmt.Sprintf("%s (user data %#x): %s", OpCodeName(e.OpCode), e.UserData, e.Errno.Error())
+	}
+
+	return fmt.Sprintf("completion (user data %#x): %s", e.UserData, e.Errno.Error())
+}
+
+// Unwrap returns the syscall.Errno, so errors.Is(err, syscall.ECANCELED)
+// and similar checks work.
+func (e *CQEError) Unwrap() error {
+	return e.Errno
+}
+
+// Err returns a *CQEError if the request failed, or nil.
+func (c *CompletionQueueEvent) Err() error {
+	if c.Res >= 0 {
+		return nil
+	}
+
+	return &CQEError{
+		UserData: c.UserData,
+		Errno:    syscall.Errno(-c.Res),
+	}
+}
+
+// ErrWithOp is like Err, with the Op* opcode of the request added to the
+// error.
+func (c *CompletionQueueEvent) ErrWithOp(op uint8) error {
+	if c.Res >= 0 {
+		return nil
+	}
+
+	return &CQEError{
+		UserData:  c.UserData,
+		Errno:     syscall.Errno(-c.Res),
+		OpCode:    op,
+		HasOpCode: true,
+	}
+}
+
+// Result returns the non-negative result of the request, or Err.
+func (c *CompletionQueueEvent) Result() (int32, error) {
+	if c.Res < 0 {
+		return 0, c.Err()
+	}
+
+	return c.Res, nil
+}
+
+// BufferID returns the ID of the provided buffer the kernel picked, if any.
+func (c *CompletionQueueEvent) BufferID() (uint16, bool) {
+	if c.Flags&CQEFBuffer == 0 {
+		return 0, false
+	}
+
+	return uint16(c.Flags >> CQEBufferShift), true
+}
+
+// More reports whether the multishot request will post more completions.
+func (c *CompletionQueueEvent) More() bool {
+	return c.Flags&CQEFMore != 0
+}
+
+// IsNotification reports whether the completion is the buffer release
+// notification of a zero copy send.
+func (c *CompletionQueueEvent) IsNotification() bool {
+	return c.Flags&CQEFNotif != 0
+}
+
+// SocketNonEmpty reports whether the socket still had data queued after a
+// receive.
+func (c *CompletionQueueEvent) SocketNonEmpty() bool {
+	return c.Flags&CQEFSockNonempty != 0
+}
+
+const cqeExtraDataLen = 2
+
+// ExtraData returns the 16 extra bytes of a 32 byte completion, such as the
+// second result of a uring_cmd, as two uint64 values. It returns nil unless
+// the ring was set up with SetupCQE32 and cqe was handed out by this ring.
+// The slice refers to the completion queue and is only valid until the
+// event is marked as seen.
+func (ring *Ring) ExtraData(cqe *CompletionQueueEvent) []uint64 {
+	if ring.flags&SetupCQE32 == 0 || cqe == nil || ring.cqRing.cqes == nil {
+		return nil
+	}
+
+	size := 2 * unsafe.Sizeof(CompletionQueueEvent{})
+	start := uintptr(unsafe.Pointer(ring.cqRing.cqes))
+	ptr := uintptr(unsafe.Pointer(cqe))
+	if ptr < start || ptr >= start+uintptr(*ring.cqRing.ringEntries)*size || (ptr-start)%size != 0 {
+		return nil
+	}
+
+	return unsafe.Slice((*uint64)(unsafe.Add(unsafe.Pointer(cqe), unsafe.Sizeof(CompletionQueueEvent{}))), cqeExtraDataLen)
+}
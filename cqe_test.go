@@ -0,0 +1,139 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func TestCQEAccessors(t *testing.T) {
+	cqe := &CompletionQueueEvent{
+		UserData: 7,
+		Res:      42,
+		Flags:    CQEFBuffer | CQEFMore | CQEFSockNonempty | 5<<CQEBufferShift,
+	}
+
+	NoError(t, cqe.Err())
+	NoError(t, cqe.ErrWithOp(OpRecv))
+	res, err := cqe.Result()
+	NoError(t, err)
+	Equal(t, int32(42), res)
+
+	bid, ok := cqe.BufferID()
+	True(t, ok)
+	Equal(t, uint16(5), bid)
+	True(t, cqe.More())
+	True(t, cqe.SocketNonEmpty())
+	False(t, cqe.IsNotification())
+
+	cqe = &CompletionQueueEvent{Flags: CQEFNotif}
+	_, ok = cqe.BufferID()
+	False(t, ok)
+	False(t, cqe.More())
+	True(t, cqe.IsNotification())
+}
+
+func TestCQEErr(t *testing.T) {
+	cqe := &CompletionQueueEvent{UserData: 0x10, Res: -int32(syscall.ECANCELED)}
+
+	err := cqe.Err()
+	ErrorIs(t, err, syscall.ECANCELED)
+	Equal(t, "completion (user data 0x10): operation canceled", err.Error())
+
+	res, err := cqe.Result()
+	ErrorIs(t, err, syscall.ECANCELED)
+	Zero(t, res)
+
+	err = cqe.ErrWithOp(OpRecv)
+	ErrorIs(t, err, syscall.ECANCELED)
+	Equal(t, "OpRecv (user data 0x10): operation canceled", err.Error())
+
+	var cqeErr *CQEError
+	True(t, errors.As(err, &cqeErr))
+	True(t, cqeErr.HasOpCode)
+	Equal(t, OpRecv, cqeErr.OpCode)
+	Equal(t, uint64(0x10), cqeErr.UserData)
+}
+
+// IORING_NOP_CQE32 makes a NOP fill the extra CQE32 data from off and addr.
+const nopCQE32 = 1 << 5
+
+func TestExtraData(t *testing.T) {
+	ring := NewRing()
+	NoError(t, ring.QueueInit(4, SetupCQE32))
+
+	defer ring.QueueExit()
+
+	for i := uint64(0); i < 2; i++ {
+		sqe := ring.GetSQE()
+		sqe.PrepareNop()
+		sqe.OpcodeFlags = nopCQE32
+		sqe.Off = 0x1000 + i
+		sqe.Addr = 0x2000 + i
+		sqe.UserData = i
+	}
+	_, err := ring.SubmitAndWait(2)
+	NoError(t, err)
+
+	cqe, err := ring.WaitCQE()
+	NoError(t, err)
+	if cqe.Res == -int32(syscall.EINVAL) {
+		t.Skip("IORING_NOP_CQE32 is not supported by this kernel")
+	}
+	Equal(t, []uint64{0x1000, 0x2000}, ring.ExtraData(cqe))
+
+	cqes := make([]*CompletionQueueEvent, 4)
+	Equal(t, uint32(2), ring.PeekBatchCQE(cqes))
+	for i, cqe := range cqes[:2] {
+		Equal(t, uint64(i), cqe.UserData)
+		Equal(t, []uint64{0x1000 + uint64(i), 0x2000 + uint64(i)}, ring.ExtraData(cqe))
+	}
+
+	var extra [][]uint64
+	ring.ForEachCQE(func(cqe *CompletionQueueEvent) {
+		extra = append(extra, ring.ExtraData(cqe))
+	})
+	Equal(t, [][]uint64{{0x1000, 0x2000}, {0x1001, 0x2001}}, extra)
+	ring.CQAdvance(2)
+
+	Nil(t, ring.ExtraData(&CompletionQueueEvent{}))
+	Nil(t, ring.ExtraData(nil))
+}
+
+func TestExtraDataWithoutCQE32(t *testing.T) {
+	ring, err := CreateRing(4)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	NoError(t, queueNOPs(t, ring, 1, 0))
+	cqe, err := ring.WaitCQE()
+	NoError(t, err)
+	Nil(t, ring.ExtraData(cqe))
+	ring.CQESeen(cqe)
+}
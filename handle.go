@@ -0,0 +1,174 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"errors"
+)
+
+// ErrStaleHandle is returned when resolving a handle which is not live: its
+// value was already released, for example by an earlier final completion,
+// or the handle never came from the table.
+var ErrStaleHandle = errors.New("stale or unknown handle")
+
+// Handles keep the top bit clear, so they never collide with the user data
+// reserved by the ring.
+const (
+	handleIndexBits        = 32
+	handleIndexMask uint64 = 1<<handleIndexBits - 1
+	handleMaxGen    uint32 = 1<<31 - 1
+)
+
+// HandleTable stores Go values for in flight requests and issues 64-bit
+// handles for them to use as user data. Unlike SetData, the values stay
+// visible to the garbage collector while the kernel holds the handle. Each
+// handle is tagged with the generation of its slot, so completions for
+// released values are detected instead of resolving to the wrong value.
+//
+// A HandleTable is not safe for concurrent use, like the Ring it is used
+// with.
+type HandleTable[T any] struct {
+	slots []handleSlot[T]
+	free  []uint32
+	live  int
+}
+
+type handleSlot[T any] struct {
+	value T
+	gen   uint32
+	live  bool
+}
+
+// NewHandleTable returns a table with room for capacity values before it
+// grows.
+func NewHandleTable[T any](capacity int) *HandleTable[T] {
+	return &HandleTable[T]{
+		slots: make([]handleSlot[T], 0, capacity),
+	}
+}
+
+// Insert stores value and returns its handle. Handles are never 0.
+func (t *HandleTable[T]) Insert(value T) uint64 {
+	var index uint32
+
+	if n := len(t.free); n > 0 {
+		index = t.free[n-1]
+		t.free = t.free[:n-1]
+	} else {
+		index = uint32(len(t.slots))
+		t.slots = append(t.slots, handleSlot[T]{})
+	}
+
+	slot := &t.slots[index]
+	if slot.gen == handleMaxGen {
+		slot.gen = 0
+	}
+	slot.gen++
+	slot.value = value
+	slot.live = true
+	t.live++
+
+	return uint64(slot.gen)<<handleIndexBits | uint64(index)
+}
+
+// Attach stores value and sets its handle as the user data of sqe. It must
+// be called after the Prepare function, which clears the user data.
+func (t *HandleTable[T]) Attach(sqe *SubmissionQueueEntry, value T) uint64 {
+	handle := t.Insert(value)
+	sqe.UserData = handle
+
+	return handle
+}
+
+func (t *HandleTable[T]) slot(handle uint64) *handleSlot[T] {
+	index := handle & handleIndexMask
+	if index >= uint64(len(t.slots)) {
+		return nil
+	}
+
+	slot := &t.slots[index]
+	if !slot.live || uint64(slot.gen) != handle>>handleIndexBits {
+		return nil
+	}
+
+	return slot
+}
+
+// Get returns the value of a live handle.
+func (t *HandleTable[T]) Get(handle uint64) (T, bool) {
+	slot := t.slot(handle)
+	if slot == nil {
+		var zero T
+
+		return zero, false
+	}
+
+	return slot.value, true
+}
+
+// Release removes the value of a live handle and returns it. The handle
+// becomes stale.
+func (t *HandleTable[T]) Release(handle uint64) (T, bool) {
+	var zero T
+
+	slot := t.slot(handle)
+	if slot == nil {
+		return zero, false
+	}
+
+	value := slot.value
+	slot.value = zero
+	slot.live = false
+	t.free = append(t.free, uint32(handle&handleIndexMask))
+	t.live--
+
+	return value, true
+}
+
+// Resolve returns the value of the request which produced cqe. The value is
+// released by the final completion of the request, so further completions
+// with the same handle return ErrStaleHandle; completions flagged with
+// CQEFMore keep it.
+func (t *HandleTable[T]) Resolve(cqe *CompletionQueueEvent) (T, error) {
+	if cqe.More() {
+		value, ok := t.Get(cqe.UserData)
+		if !ok {
+			return value, ErrStaleHandle
+		}
+
+		return value, nil
+	}
+
+	value, ok := t.Release(cqe.UserData)
+	if !ok {
+		return value, ErrStaleHandle
+	}
+
+	return value, nil
+}
+
+// Len returns the number of live handles.
+func (t *HandleTable[T]) Len() int {
+	return t.live
+}
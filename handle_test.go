@@ -0,0 +1,112 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+type handleRequest struct {
+	name string
+	buf  []byte
+}
+
+func TestHandleTable(t *testing.T) {
+	table := NewHandleTable[*handleRequest](2)
+
+	first := table.Insert(&handleRequest{name: "first"})
+	second := table.Insert(&handleRequest{name: "second"})
+	NotZero(t, first)
+	NotEqual(t, first, second)
+	Equal(t, 2, table.Len())
+
+	value, ok := table.Get(first)
+	True(t, ok)
+	Equal(t, "first", value.name)
+
+	value, ok = table.Release(first)
+	True(t, ok)
+	Equal(t, "first", value.name)
+	_, ok = table.Get(first)
+	False(t, ok)
+	_, ok = table.Release(first)
+	False(t, ok)
+
+	// The slot is reused with a new generation.
+	third := table.Insert(&handleRequest{name: "third"})
+	Equal(t, first&handleIndexMask, third&handleIndexMask)
+	NotEqual(t, first, third)
+	_, ok = table.Get(first)
+	False(t, ok)
+	Equal(t, 2, table.Len())
+
+	_, ok = table.Get(1 << 20)
+	False(t, ok)
+	Zero(t, third>>63)
+}
+
+func TestHandleTableResolve(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	table := NewHandleTable[*handleRequest](8)
+
+	for i := 0; i < 4; i++ {
+		sqe := ring.GetSQE()
+		sqe.PrepareNop()
+		table.Attach(sqe, &handleRequest{name: "nop", buf: make([]byte, 16)})
+	}
+	Equal(t, 4, table.Len())
+
+	_, err = ring.SubmitAndWait(4)
+	NoError(t, err)
+
+	var cqes []CompletionQueueEvent
+	for cqe := range ring.Completions() {
+		value, err := table.Resolve(cqe)
+		NoError(t, err)
+		Equal(t, "nop", value.name)
+		cqes = append(cqes, *cqe)
+	}
+	Len(t, cqes, 4)
+	Zero(t, table.Len())
+
+	// A duplicate completion is detected.
+	_, err = table.Resolve(&cqes[0])
+	ErrorIs(t, err, ErrStaleHandle)
+
+	// Multishot completions keep the value until the final one.
+	handle := table.Insert(&handleRequest{name: "multishot"})
+	value, err := table.Resolve(&CompletionQueueEvent{UserData: handle, Flags: CQEFMore})
+	NoError(t, err)
+	Equal(t, "multishot", value.name)
+	_, err = table.Resolve(&CompletionQueueEvent{UserData: handle})
+	NoError(t, err)
+	_, err = table.Resolve(&CompletionQueueEvent{UserData: handle})
+	ErrorIs(t, err, ErrStaleHandle)
+}
@@ -0,0 +1,250 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"math/bits"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	hugePagesDir = "/sys/kernel/mm/hugepages"
+	// liburing: KRING_SIZE
+	kringSize      = 64
+	mapHugeShift   = 26
+	sqeSize        = uint64(unsafe.Sizeof(SubmissionQueueEntry{}))
+	cqeSize        = uint64(unsafe.Sizeof(CompletionQueueEvent{}))
+	sqArrayEntSize = uint64(unsafe.Sizeof(uint32(0)))
+)
+
+var (
+	hugePageSizesOnce sync.Once
+	hugePageSizes     []uint64
+)
+
+// HugePageSizes returns the huge page sizes supported by the system in
+// ascending order. The sizes are read from sysfs once per process. Whether
+// pages of a given size are actually reserved is only known when mapping
+// them.
+func HugePageSizes() []uint64 {
+	hugePageSizesOnce.Do(func() {
+		hugePageSizes = readHugePageSizes(hugePagesDir)
+	})
+
+	return hugePageSizes
+}
+
+func readHugePageSizes(dir string) []uint64 {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var sizes []uint64
+	for _, entry := range entries {
+		name := strings.TrimPrefix(entry.Name(), "hugepages-")
+		if name == entry.Name() || !strings.HasSuffix(name, "kB") {
+			continue
+		}
+		size, err := strconv.ParseUint(strings.TrimSuffix(name, "kB"), 10, 64)
+		if err != nil || size == 0 {
+			continue
+		}
+		sizes = append(sizes, size*1024)
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+
+	return sizes
+}
+
+func alignUp(size, align uint64) uint64 {
+	return (size + align - 1) &^ (align - 1)
+}
+
+// ringMemSizes returns the sizes of the SQE area and of the ring area, laid
+// out as the kernel expects them.
+func ringMemSizes(sqEntries, cqEntries uint32, flags uint32) (uint64, uint64) {
+	sqes := uint64(sqEntries) * sqeSize
+	if flags&SetupSQE128 != 0 {
+		sqes *= 2
+	}
+
+	cqes := uint64(cqEntries) * cqeSize
+	if flags&SetupCQE32 != 0 {
+		cqes *= 2
+	}
+	rings := alignUp(kringSize+cqes, kringSize) + uint64(sqEntries)*sqArrayEntSize
+
+	return sqes, rings
+}
+
+// RingMemSize returns the number of bytes QueueInitMem needs for a ring with
+// the given number of entries and parameters.
+func RingMemSize(entries uint32, p *Params) (uint64, error) {
+	var sqEntries, cqEntries uint32
+
+	err := getSqCqEntries(entries, p, &sqEntries, &cqEntries)
+	if err != nil {
+		return 0, err
+	}
+
+	pageSize := uint64(os.Getpagesize())
+	sqes, rings := ringMemSizes(sqEntries, cqEntries, p.flags)
+
+	return alignUp(sqes, pageSize) + alignUp(rings, pageSize), nil
+}
+
+// mapRingMem maps anonymous memory for ring structures. The smallest huge
+// page which holds size is preferred, since the kernel needs the memory to
+// be physically contiguous on older releases. If no huge page is available
+// the memory is backed by normal pages. It returns the mapped length and
+// whether a huge page is used.
+func mapRingMem(size uint64) (unsafe.Pointer, uint64, bool, error) {
+	pageSize := uint64(os.Getpagesize())
+	flags := syscall.MAP_SHARED | syscall.MAP_ANONYMOUS
+
+	if size > pageSize {
+		for _, hugeSize := range HugePageSizes() {
+			if hugeSize < size {
+				continue
+			}
+			hugeFlags := flags | syscall.MAP_HUGETLB | bits.TrailingZeros64(hugeSize)<<mapHugeShift
+			ptr, err := sysMmap(0, uintptr(hugeSize), syscall.PROT_READ|syscall.PROT_WRITE, hugeFlags, -1, 0)
+			if err == nil {
+				return ptr, hugeSize, true, nil
+			}
+		}
+	}
+
+	size = alignUp(size, pageSize)
+	ptr, err := sysMmap(0, uintptr(size), syscall.PROT_READ|syscall.PROT_WRITE, flags, -1, 0)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	return ptr, size, false, nil
+}
+
+// RingArena is a block of memory from which rings created with SetupNoMmap
+// are carved. It is backed by a huge page when one is available and by
+// normal pages otherwise.
+type RingArena struct {
+	mu       sync.Mutex
+	ptr      unsafe.Pointer
+	size     uint64
+	used     uint64
+	hugePage bool
+}
+
+// NewRingArena maps an arena of at least size bytes. RingMemSize tells how
+// much memory a ring needs.
+func NewRingArena(size uint64) (*RingArena, error) {
+	if size == 0 {
+		return nil, syscall.EINVAL
+	}
+
+	ptr, mapped, huge, err := mapRingMem(size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RingArena{
+		ptr:      ptr,
+		size:     mapped,
+		hugePage: huge,
+	}, nil
+}
+
+// Size returns the mapped size of the arena.
+func (a *RingArena) Size() uint64 {
+	return a.size
+}
+
+// HugePage reports whether the arena is backed by a huge page.
+func (a *RingArena) HugePage() bool {
+	return a.hugePage
+}
+
+// Available returns the number of bytes not yet handed out to rings.
+func (a *RingArena) Available() uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.size - a.used
+}
+
+func (a *RingArena) alloc(size uint64) (unsafe.Pointer, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.ptr == nil {
+		return nil, syscall.EBADF
+	}
+
+	offset := alignUp(a.used, uint64(os.Getpagesize()))
+	if offset+size > a.size {
+		return nil, syscall.ENOMEM
+	}
+	a.used = offset + size
+
+	return unsafe.Add(a.ptr, offset), nil
+}
+
+// Close unmaps the arena. All the rings placed in it must have exited.
+func (a *RingArena) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.ptr == nil {
+		return nil
+	}
+	err := sysMunmap(uintptr(a.ptr), uintptr(a.size))
+	a.ptr = nil
+
+	return err
+}
+
+// QueueInitArena sets up a SetupNoMmap ring whose memory is taken from
+// arena. The memory is not returned to the arena when the ring exits.
+func (ring *Ring) QueueInitArena(entries uint32, p *Params, arena *RingArena) error {
+	p.flags |= SetupNoMmap
+
+	size, err := RingMemSize(entries, p)
+	if err != nil {
+		return err
+	}
+
+	buf, err := arena.alloc(size)
+	if err != nil {
+		return err
+	}
+
+	return ring.QueueInitMem(entries, p, buf, size)
+}
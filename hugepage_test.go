@@ -0,0 +1,104 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func TestReadHugePageSizes(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"hugepages-1048576kB", "hugepages-2048kB", "hugepages-xkB", "other"} {
+		NoError(t, os.Mkdir(filepath.Join(dir, name), 0o755))
+	}
+
+	Equal(t, []uint64{2 << 20, 1 << 30}, readHugePageSizes(dir))
+	Nil(t, readHugePageSizes(filepath.Join(dir, "missing")))
+}
+
+func TestRingMemSize(t *testing.T) {
+	size, err := RingMemSize(8, &Params{})
+	NoError(t, err)
+	Equal(t, uint64(2*os.Getpagesize()), size)
+
+	// 64 SQEs of 128 bytes and 128 CQEs of 32 bytes.
+	size, err = RingMemSize(64, &Params{flags: SetupSQE128 | SetupCQE32})
+	NoError(t, err)
+	Equal(t, uint64(8192+alignUp(4416, uint64(os.Getpagesize()))), size)
+
+	_, err = RingMemSize(0, &Params{})
+	ErrorIs(t, err, syscall.EINVAL)
+}
+
+func TestQueueInitNoMmap(t *testing.T) {
+	for _, entries := range []uint32{8, 512} {
+		ring := NewRing()
+		NoError(t, ring.QueueInit(entries, SetupNoMmap))
+
+		NoError(t, queueNOPs(t, ring, 8, 0))
+		_, err := ring.WaitCQENr(8)
+		NoError(t, err)
+		Equal(t, uint32(8), ring.CQReady())
+		ring.CQAdvance(8)
+
+		ring.QueueExit()
+	}
+}
+
+func TestQueueInitArena(t *testing.T) {
+	size, err := RingMemSize(16, &Params{})
+	NoError(t, err)
+
+	arena, err := NewRingArena(2 * size)
+	NoError(t, err)
+	GreaterOrEqual(t, arena.Size(), 2*size)
+
+	first := NewRing()
+	NoError(t, first.QueueInitArena(16, &Params{}, arena))
+	second := NewRing()
+	NoError(t, second.QueueInitArena(16, &Params{}, arena))
+	Equal(t, arena.Size()-2*size, arena.Available())
+
+	if arena.Available() < size {
+		ErrorIs(t, NewRing().QueueInitArena(16, &Params{}, arena), syscall.ENOMEM)
+	}
+
+	for i, ring := range []*Ring{first, second} {
+		NoError(t, queueNOPs(t, ring, 4, i*4))
+		_, err = ring.WaitCQENr(4)
+		NoError(t, err)
+		Equal(t, uint32(4), ring.CQReady())
+		ring.CQAdvance(4)
+	}
+
+	first.QueueExit()
+	second.QueueExit()
+	NoError(t, arena.Close())
+	NoError(t, arena.Close())
+}
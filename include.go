@@ -88,7 +88,9 @@ type SubmissionQueueEntry struct {
 	SpliceFdIn int32
 	Addr3      uint64
 	_pad2      [1]uint64
-	// TODO: add __u8	cmd[0];
+	// Addr3 and _pad2 start the command area of OpUringCmd (cmd[0] in
+	// liburing), which extends into the second half of the entry on rings
+	// set up with SetupSQE128. See Ring.Cmd.
 }
 
 const FileIndexAlloc uint32 = 4294967295
@@ -172,6 +174,20 @@ const (
 	OpUringCmd
 	OpSendZC
 	OpSendMsgZC
+	OpReadMultishot
+	OpWaitid
+	OpFutexWait
+	OpFutexWake
+	OpFutexWaitv
+	OpFixedFdInstall
+	OpFtruncate
+	OpBind
+	OpListen
+	OpRecvZC
+	OpEpollWait
+	OpReadvFixed
+	OpWritevFixed
+	OpPipe
 
 	OpLast
 )
@@ -226,8 +242,6 @@ const (
 	MsgSendFd
 )
 
-var msgDataVar = MsgData
-
 const (
 	MsgRingCQESkip uint32 = 1 << iota
 	MsgRingFlagsPass
@@ -239,8 +253,8 @@ type CompletionQueueEvent struct {
 	Res      int32
 	Flags    uint32
 
-	// FIXME
-	// 	__u64 big_cqe[];
+	// On rings set up with SetupCQE32 the event is followed by 16 more
+	// bytes (big_cqe[] in liburing), see Ring.ExtraData.
 }
 
 const (
@@ -302,6 +316,9 @@ const (
 	EnterSQWait
 	EnterExtArg
 	EnterRegisteredRing
+	EnterAbsTimer
+	EnterExtArgReg
+	EnterNoIOWait
 )
 
 // liburing: io_uring_params
@@ -334,6 +351,10 @@ const (
 	FeatCQESkip
 	FeatLinkedFile
 	FeatRegRegRing
+	FeatRecvsendBundle
+	FeatMinTimeout
+	FeatRWAttr
+	FeatNoIOWait
 )
 
 const (
@@ -376,6 +397,23 @@ const (
 
 	RegisterFileAllocRange
 
+	RegisterPbufStatus
+
+	RegisterNapi
+	UnregisterNapi
+
+	RegisterClock
+
+	RegisterCloneBuffers
+
+	RegisterSendMsgRing
+
+	RegisterZcrxIfq
+
+	RegisterResizeRings
+
+	RegisterMemRegion
+
 	RegisterLast
 
 	RegisterUseRegisteredRing = 1 << 31
@@ -488,10 +526,10 @@ const (
 
 // liburing: io_uring_getevents_arg
 type GetEventsArg struct {
-	sigMask   uint64
-	sigMaskSz uint32
-	pad       uint32
-	ts        uint64
+	sigMask     uint64
+	sigMaskSz   uint32
+	minWaitUsec uint32
+	ts          uint64
 }
 
 // liburing: io_uring_sync_cancel_reg
@@ -503,6 +541,46 @@ type SyncCancelReg struct {
 	Pad     [4]uint64
 }
 
+// liburing: io_uring_clock_register
+type ClockRegister struct {
+	ClockID uint32
+	Resv    [3]uint32
+}
+
+// liburing: io_uring_reg_wait
+type RegWait struct {
+	Ts          syscall.Timespec
+	MinWaitUsec uint32
+	Flags       uint32
+	Sigmask     uint64
+	SigmaskSz   uint32
+	Pad         [3]uint32
+	Pad2        [2]uint64
+}
+
+const RegWaitTs uint32 = 1 << 0
+
+// liburing: io_uring_region_desc
+type RegionDesc struct {
+	UserAddr   uint64
+	Size       uint64
+	Flags      uint32
+	ID         uint32
+	MmapOffset uint64
+	Resv       [4]uint64
+}
+
+const MemRegionTypeUser uint32 = 1
+
+// liburing: io_uring_mem_region_reg
+type MemRegionReg struct {
+	RegionUptr uint64
+	Flags      uint64
+	Resv       [2]uint64
+}
+
+const MemRegionRegWaitArg uint64 = 1
+
 // liburing: io_uring_file_index_range
 type FileIndexRange struct {
 	Off  uint32
@@ -521,4 +599,6 @@ type RecvmsgOut struct {
 const (
 	SocketUringOpSiocinq = iota
 	SocketUringOpSiocoutq
+	SocketUringOpGetsockopt
+	SocketUringOpSetsockopt
 )
@@ -0,0 +1,168 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// FeatureSet holds the Feat* flags reported by the kernel during ring setup.
+type FeatureSet uint32
+
+var featureNames = [...]string{
+	"SingleMMap",
+	"NoDrop",
+	"SubmitStable",
+	"RWCurPos",
+	"CurPersonality",
+	"FastPoll",
+	"Poll32Bits",
+	"SQPollNonfixed",
+	"ExtArg",
+	"NativeWorkers",
+	"RsrcTags",
+	"CQESkip",
+	"LinkedFile",
+	"RegRegRing",
+	"RecvsendBundle",
+	"MinTimeout",
+	"RWAttr",
+	"NoIOWait",
+}
+
+// Has reports whether all the given Feat* flags are set.
+func (s FeatureSet) Has(features uint32) bool {
+	return uint32(s)&features == features
+}
+
+func (s FeatureSet) String() string {
+	return flagsString(uint32(s), featureNames[:])
+}
+
+// SetupFlags holds the Setup* flags a ring was created with.
+type SetupFlags uint32
+
+var setupFlagNames = [...]string{
+	"IOPoll",
+	"SQPoll",
+	"SQAff",
+	"CQSize",
+	"Clamp",
+	"AttachWQ",
+	"RDisabled",
+	"SubmitAll",
+	"CoopTaskrun",
+	"TaskrunFlag",
+	"SQE128",
+	"CQE32",
+	"SingleIssuer",
+	"DeferTaskrun",
+	"NoMmap",
+	"RegisteredFdOnly",
+}
+
+// Has reports whether all the given Setup* flags are set.
+func (f SetupFlags) Has(flags uint32) bool {
+	return uint32(f)&flags == flags
+}
+
+func (f SetupFlags) String() string {
+	return flagsString(uint32(f), setupFlagNames[:])
+}
+
+func flagsString(value uint32, names []string) string {
+	if value == 0 {
+		return "0"
+	}
+
+	var (
+		builder strings.Builder
+		unknown uint32
+	)
+
+	for value != 0 {
+		bit := bits.TrailingZeros32(value)
+		value &^= 1 << bit
+
+		if bit >= len(names) {
+			unknown |= 1 << bit
+
+			continue
+		}
+		if builder.Len() > 0 {
+			builder.WriteByte('|')
+		}
+		builder.WriteString(names[bit])
+	}
+
+	if unknown != 0 {
+		if builder.Len() > 0 {
+			builder.WriteByte('|')
+		}
+		fmt.Fprintf(&builder, "%#x", unknown)
+	}
+
+	return builder.String()
+}
+
+// RingInfo is a snapshot of the state negotiated with the kernel and of the
+// ring counters.
+type RingInfo struct {
+	Fd           int
+	RegisteredFd bool
+	Features     FeatureSet
+	Flags        SetupFlags
+	SQEntries    uint32
+	CQEntries    uint32
+	SQThreadCPU  uint32
+	SQThreadIdle time.Duration
+	// SQDropped is the number of invalid entries the kernel skipped.
+	SQDropped uint32
+	// CQOverflow is the number of completions lost because the CQ was full.
+	CQOverflow uint32
+	SQReady    uint32
+	CQReady    uint32
+}
+
+// Info returns a snapshot of the ring setup and counters.
+func (ring *Ring) Info() RingInfo {
+	return RingInfo{
+		Fd:           ring.ringFd,
+		RegisteredFd: ring.intFlags&IntFlagRegRing != 0,
+		Features:     FeatureSet(ring.features),
+		Flags:        SetupFlags(ring.flags),
+		SQEntries:    *ring.sqRing.ringEntries,
+		CQEntries:    *ring.cqRing.ringEntries,
+		SQThreadCPU:  ring.params.sqThreadCPU,
+		SQThreadIdle: ring.params.SQThreadIdle(),
+		SQDropped:    atomic.LoadUint32(ring.sqRing.dropped),
+		CQOverflow:   atomic.LoadUint32(ring.cqRing.overflow),
+		SQReady:      ring.SQReady(),
+		CQReady:      ring.CQReady(),
+	}
+}
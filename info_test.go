@@ -0,0 +1,78 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func TestFeatureSetString(t *testing.T) {
+	Equal(t, "0", FeatureSet(0).String())
+	Equal(t, "SingleMMap|NoDrop", FeatureSet(FeatSingleMMap|FeatNoDrop).String())
+	Equal(t, "ExtArg|0x80000000", FeatureSet(FeatExtArg|1<<31).String())
+
+	features := FeatureSet(FeatSingleMMap | FeatExtArg)
+	True(t, features.Has(FeatExtArg))
+	True(t, features.Has(FeatSingleMMap|FeatExtArg))
+	False(t, features.Has(FeatExtArg|FeatNoDrop))
+}
+
+func TestSetupFlagsString(t *testing.T) {
+	Equal(t, "SQPoll|SQAff", SetupFlags(SetupSQPoll|SetupSQAff).String())
+	Equal(t, "SingleIssuer|DeferTaskrun", SetupFlags(SetupSingleIssuer|SetupDeferTaskrun).String())
+	True(t, SetupFlags(SetupCQSize|SetupClamp).Has(SetupClamp))
+	False(t, SetupFlags(SetupCQSize).Has(SetupClamp))
+}
+
+func TestRingInfo(t *testing.T) {
+	ring, err := NewRingWithOptions(8, WithCQSize(32))
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	info := ring.Info()
+	Equal(t, ring.RingFd(), info.Fd)
+	False(t, info.RegisteredFd)
+	Equal(t, uint32(8), info.SQEntries)
+	Equal(t, uint32(32), info.CQEntries)
+	True(t, info.Flags.Has(SetupCQSize))
+	True(t, info.Features.Has(FeatSingleMMap))
+	Zero(t, info.SQDropped)
+	Zero(t, info.CQOverflow)
+
+	entry := ring.GetSQE()
+	NotNil(t, entry)
+	entry.PrepareNop()
+	Equal(t, uint32(1), ring.Info().SQReady)
+
+	_, err = ring.SubmitAndWait(1)
+	NoError(t, err)
+
+	info = ring.Info()
+	Zero(t, info.SQReady)
+	Equal(t, uint32(1), info.CQReady)
+	ring.CQAdvance(1)
+}
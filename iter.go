@@ -0,0 +1,62 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import "iter"
+
+// Completions returns an iterator over the completions which are ready. It
+// does not wait. Each event is marked as seen as soon as the loop body is
+// done with it, also when the loop is left early, so events must not be
+// kept past their iteration. When the queue runs empty, overflowed
+// completions and deferred task work are flushed with GetEvents.
+func (ring *Ring) Completions() iter.Seq[*CompletionQueueEvent] {
+	return func(yield func(*CompletionQueueEvent) bool) {
+		var flushed bool
+
+		for {
+			cqe, err := internalPeekCQE(ring, nil)
+			if err != nil {
+				// A failed internal timeout, already consumed.
+				continue
+			}
+
+			if cqe == nil {
+				if flushed || !ring.cqRingNeedsFlush() {
+					return
+				}
+				_, _ = ring.GetEvents()
+				flushed = true
+
+				continue
+			}
+			flushed = false
+
+			more := yield(cqe)
+			ring.CQAdvance(1)
+			if !more {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,84 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func TestCompletions(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	NoError(t, queueNOPs(t, ring, 5, 0))
+	_, err = ring.WaitCQENr(5)
+	NoError(t, err)
+
+	var seen []uint64
+	for cqe := range ring.Completions() {
+		seen = append(seen, cqe.UserData)
+		if len(seen) == 2 {
+			break
+		}
+	}
+	Equal(t, []uint64{0, 1}, seen)
+	Equal(t, uint32(3), ring.CQReady())
+
+	for cqe := range ring.Completions() {
+		seen = append(seen, cqe.UserData)
+	}
+	Equal(t, []uint64{0, 1, 2, 3, 4}, seen)
+	Equal(t, uint32(0), ring.CQReady())
+
+	for range ring.Completions() {
+		t.Fatal("no completions expected")
+	}
+}
+
+func TestCompletionsOverflow(t *testing.T) {
+	ring, err := NewRingWithOptions(2, WithCQSize(2))
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	if ring.features&FeatNoDrop == 0 {
+		t.Skip("overflowed completions are dropped by this kernel")
+	}
+
+	for i := 0; i < 4; i++ {
+		NoError(t, queueNOPs(t, ring, 2, 2*i))
+	}
+	True(t, ring.CQHasOverflow())
+
+	var seen []uint64
+	for cqe := range ring.Completions() {
+		seen = append(seen, cqe.UserData)
+	}
+	Equal(t, []uint64{0, 1, 2, 3, 4, 5, 6, 7}, seen)
+	False(t, ring.CQHasOverflow())
+}
@@ -48,6 +48,7 @@ type SubmissionQueue struct {
 
 	ringSize uint
 	ringPtr  unsafe.Pointer
+	sqesSize uint
 
 	sqeHead uint32
 	sqeTail uint32
@@ -86,6 +87,32 @@ type Ring struct {
 	pad [3]uint8
 	// nolint: unused
 	pad2 uint32
+
+	params Params
+
+	wqParent   *Ring
+	wqChildren int
+	wqExiting  bool
+
+	bufRings map[uint16]bufRingMem
+
+	batchOpen bool
+
+	ctxWake    *ctxWaker
+	hasMailbox bool
+
+	// clockID is the clock of the wait timeouts, set by RegisterClock.
+	clockID int32
+
+	waitRegion *WaitRegion
+
+	sqFullPolicy SQFullPolicy
+}
+
+// bufRingMem is the memory of a buffer ring allocated by SetupBufRing.
+type bufRingMem struct {
+	ptr  uintptr
+	size uintptr
 }
 
 // liburing: io_uring_cqe_shift
@@ -102,15 +129,62 @@ func (ring *Ring) cqeIndex(ptr, mask uint32) uintptr {
 	return uintptr((ptr & mask) << ring.cqeShift())
 }
 
+func (ring *Ring) cqeAt(head uint32) *CompletionQueueEvent {
+	cqeIndex := ring.cqeIndex(head, *ring.cqRing.ringMask)
+
+	return (*CompletionQueueEvent)(
+		unsafe.Add(unsafe.Pointer(ring.cqRing.cqes), cqeIndex*unsafe.Sizeof(CompletionQueueEvent{})),
+	)
+}
+
+// hasInternalCQEs reports whether completions of the ring may be internal
+// ones which the reaping functions consume.
+func (ring *Ring) hasInternalCQEs() bool {
+	return ring.ctxWake != nil || ring.hasMailbox
+}
+
+// isInternalCQE reports whether cqe is one of the internal completions of the
+// context aware waits or a successful delivery of a mailbox of the ring.
+func (ring *Ring) isInternalCQE(cqe *CompletionQueueEvent) bool {
+	if ring.ctxWake != nil && (cqe.UserData == ctxWakeUserData || cqe.UserData == ctxCancelUserData) {
+		return true
+	}
+
+	return ring.hasMailbox && isMailboxDelivery(cqe)
+}
+
+// skipInternalCQEs consumes the internal completions at the head of the
+// completion queue.
+func (ring *Ring) skipInternalCQEs() {
+	if !ring.hasInternalCQEs() {
+		return
+	}
+
+	head := *ring.cqRing.head
+	tail := atomic.LoadUint32(ring.cqRing.tail)
+	start := head
+	for head != tail && ring.isInternalCQE(ring.cqeAt(head)) {
+		head++
+	}
+	if head != start {
+		atomic.StoreUint32(ring.cqRing.head, head)
+	}
+}
+
 // liburing: io_uring_for_each_cqe - https://manpages.debian.org/unstable/liburing-dev/io_uring_for_each_cqe.3.en.html
+//
+// It stops before an internal completion of the context aware waits or of a
+// mailbox, which is consumed by the next reaping call once the preceding completions were
+// marked as seen.
 func (ring *Ring) ForEachCQE(callback func(cqe *CompletionQueueEvent)) {
 	var cqe *CompletionQueueEvent
+	ring.skipInternalCQEs()
 	for head := atomic.LoadUint32(ring.cqRing.head); ; head++ {
 		if head != atomic.LoadUint32(ring.cqRing.tail) {
-			cqeIndex := ring.cqeIndex(head, *ring.cqRing.ringMask)
-			cqe = (*CompletionQueueEvent)(
-				unsafe.Add(unsafe.Pointer(ring.cqRing.cqes), cqeIndex*unsafe.Sizeof(CompletionQueueEvent{})),
-			)
+			cqe = ring.cqeAt(head)
+			if ring.isInternalCQE(cqe) {
+				break
+			}
 			callback(cqe)
 		} else {
 			break
@@ -195,7 +269,7 @@ func (ring *Ring) CQHasOverflow() bool {
 
 // liburing: io_uring_cq_eventfd_enabled
 func (ring *Ring) CQEventfdEnabled() bool {
-	if *ring.cqRing.flags == 0 {
+	if ring.cqRing.flags == nil {
 		return true
 	}
 
@@ -210,7 +284,7 @@ func (ring *Ring) CqEventfdToggle(enabled bool) error {
 		return nil
 	}
 
-	if *ring.cqRing.flags == 0 {
+	if ring.cqRing.flags == nil {
 		return syscall.EOPNOTSUPP
 	}
 
@@ -267,6 +341,14 @@ func internalPeekCQE(ring *Ring, nrAvailable *uint32) (*CompletionQueueEvent, er
 				continue
 			}
 			cqe = nil
+
+			break
+		}
+
+		if ring.isInternalCQE(cqe) {
+			atomic.StoreUint32(ring.cqRing.head, head+1)
+
+			continue
 		}
 
 		break
@@ -304,18 +386,15 @@ func (ring *Ring) WaitCQE() (*CompletionQueueEvent, error) {
 func privateGetSQE(ring *Ring) *SubmissionQueueEntry {
 	sq := ring.sqRing
 	var head, next uint32
-	var shift int
 
-	if ring.flags&SetupSQE128 != 0 {
-		shift = 1
+	if ring.batchOpen {
+		return nil
 	}
+
 	head = atomic.LoadUint32(sq.head)
 	next = sq.sqeTail + 1
 	if next-head <= *sq.ringEntries {
-		sqe := (*SubmissionQueueEntry)(
-			unsafe.Add(unsafe.Pointer(ring.sqRing.sqes),
-				uintptr((sq.sqeTail&*sq.ringMask)<<shift)*unsafe.Sizeof(SubmissionQueueEntry{})),
-		)
+		sqe := ring.sqeAt(sq.sqeTail)
 		sq.sqeTail = next
 
 		return sqe
@@ -324,6 +403,20 @@ func privateGetSQE(ring *Ring) *SubmissionQueueEntry {
 	return nil
 }
 
+// sqeAt returns the SQE used for the given SQ tail position.
+func (ring *Ring) sqeAt(tail uint32) *SubmissionQueueEntry {
+	var shift int
+
+	if ring.flags&SetupSQE128 != 0 {
+		shift = 1
+	}
+
+	return (*SubmissionQueueEntry)(
+		unsafe.Add(unsafe.Pointer(ring.sqRing.sqes),
+			uintptr((tail&*ring.sqRing.ringMask)<<shift)*unsafe.Sizeof(SubmissionQueueEntry{})),
+	)
+}
+
 // liburing: io_uring_get_sqe - https://manpages.debian.org/unstable/liburing-dev/io_uring_get_sqe.3.en.html
 func (ring *Ring) GetSQE() *SubmissionQueueEntry {
 	return privateGetSQE(ring)
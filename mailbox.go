@@ -0,0 +1,279 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// MessageKind is the kind of a message posted through a Mailbox.
+type MessageKind uint8
+
+const (
+	// MessageData carries a 64-bit payload.
+	MessageData MessageKind = iota + 1
+	// MessageFile installed a file of the sending process in the file
+	// table of the receiving ring.
+	MessageFile
+	// MessageDirect installed a direct descriptor in the receiving ring.
+	MessageDirect
+)
+
+func (k MessageKind) String() string {
+	switch k {
+	case MessageData:
+		return "data"
+	case MessageFile:
+		return "file"
+	case MessageDirect:
+		return "direct"
+	default:
+		return fmt.Sprintf("MessageKind(%d)", uint8(k))
+	}
+}
+
+// Data messages are marked by mailboxFlagsTag in the upper 16 bits of the
+// CQE flags, which the kernel only uses together with CQEFBuffer. File and
+// direct descriptor messages get no custom flags, so they are marked by
+// mailboxFileTag and mailboxDirectTag in the top byte of the user data
+// instead. The CQEs the sender gets for its messages carry mailboxSendTag.
+const (
+	mailboxFlagsTag  uint32 = 0xfd << 24
+	mailboxFlagsMask uint32 = 0xff << 24
+	mailboxKindShift        = 16
+	mailboxDirectTag uint64 = 0xfd << 56
+	mailboxFileTag   uint64 = 0xfe << 56
+	mailboxSendTag   uint64 = 0xfb << 56
+	mailboxTagMask   uint64 = 0xff << 56
+	mailboxFromShift        = 32
+	mailboxMaxID     uint32 = 1<<24 - 1
+	mailboxSeqBits          = 48
+	mailboxSeqMask   uint64 = 1<<mailboxSeqBits - 1
+)
+
+// Message is a message received from a Mailbox.
+type Message struct {
+	Kind MessageKind
+	// From is the ID of the sending mailbox.
+	From uint32
+	// Payload is the 64-bit payload of data messages and the 32-bit
+	// payload of file and direct descriptor messages.
+	Payload uint64
+	// Fd is the index in the file table of the receiving ring of file and
+	// direct descriptor messages, the allocated one for FileIndexAlloc.
+	Fd int
+}
+
+// ParseMessage returns the message carried by cqe, if it was posted by a
+// Mailbox.
+func ParseMessage(cqe *CompletionQueueEvent) (Message, bool) {
+	if cqe.Flags&CQEFBuffer == 0 && cqe.Flags&mailboxFlagsMask == mailboxFlagsTag {
+		return Message{
+			Kind:    MessageKind(cqe.Flags >> mailboxKindShift & 0xff),
+			From:    uint32(cqe.Res),
+			Payload: cqe.UserData,
+		}, true
+	}
+	if cqe.Res < 0 {
+		return Message{}, false
+	}
+
+	var kind MessageKind
+	switch cqe.UserData & mailboxTagMask {
+	case mailboxFileTag:
+		kind = MessageFile
+	case mailboxDirectTag:
+		kind = MessageDirect
+	default:
+		return Message{}, false
+	}
+
+	return Message{
+		Kind:    kind,
+		From:    uint32(cqe.UserData>>mailboxFromShift) & mailboxMaxID,
+		Payload: cqe.UserData & 0xffffffff,
+		Fd:      int(cqe.Res),
+	}, true
+}
+
+// isMailboxDelivery reports whether cqe is the completion the sender gets
+// for a delivered message.
+func isMailboxDelivery(cqe *CompletionQueueEvent) bool {
+	if cqe.Flags&CQEFBuffer == 0 && cqe.Flags&mailboxFlagsMask == mailboxFlagsTag {
+		return false
+	}
+
+	return cqe.UserData&mailboxTagMask == mailboxSendTag && cqe.Res >= 0
+}
+
+// DeliveryError reports a message which could not be delivered, for
+// example with syscall.EOVERFLOW when the CQ of the target was full or
+// syscall.EBADFD when the target ring is disabled.
+type DeliveryError struct {
+	Seq   uint64
+	Kind  MessageKind
+	Errno syscall.Errno
+}
+
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf("%s message %d not delivered: %v", e.Kind, e.Seq, e.Errno)
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Errno
+}
+
+// Mailbox posts messages from its ring to the rings of other event loops
+// with OpMsgRing. Post functions only prepare the request; it is sent by
+// the next submit of the ring. The completions of successful deliveries are
+// consumed by the reaping functions of the sending ring and never returned
+// to the caller, failed ones are reported by Failed. User data with the top
+// byte 0xfb is reserved on rings with a mailbox.
+type Mailbox struct {
+	ring *Ring
+	id   uint32
+	seq  uint64
+}
+
+// NewMailbox returns a mailbox sending from the ring. id identifies it to
+// the receivers and must fit in 24 bits.
+func (ring *Ring) NewMailbox(id uint32) (*Mailbox, error) {
+	if id > mailboxMaxID {
+		return nil, fmt.Errorf("mailbox id %d exceeds 24 bits: %w", id, syscall.EINVAL)
+	}
+
+	ring.hasMailbox = true
+
+	return &Mailbox{ring: ring, id: id}, nil
+}
+
+// Post prepares a data message to target and returns its sequence number.
+func (m *Mailbox) Post(target *Ring, payload uint64) (uint64, error) {
+	return m.post(target, MessageData, payload)
+}
+
+// PostFile prepares a message which installs fd in the file table of target
+// at targetIndex, or in a free slot with FileIndexAlloc. fd is first
+// installed at sourceIndex of the file table of the mailbox ring, which must
+// not be updated again before the message was sent. The caller keeps the
+// ownership of fd.
+func (m *Mailbox) PostFile(target *Ring, fd int, sourceIndex int, targetIndex int, payload uint32) (uint64, error) {
+	if err := checkMailboxTarget(target); err != nil {
+		return 0, err
+	}
+	if fd < 0 {
+		return 0, fmt.Errorf("file message with fd %d: %w", fd, syscall.EBADF)
+	}
+	if _, err := m.ring.RegisterFilesUpdate(uint(sourceIndex), []int{fd}); err != nil {
+		return 0, fmt.Errorf("file message from index %d: %w", sourceIndex, err)
+	}
+
+	return m.postFd(target, MessageFile, mailboxFileTag, sourceIndex, targetIndex, payload)
+}
+
+func (m *Mailbox) post(target *Ring, kind MessageKind, payload uint64) (uint64, error) {
+	if err := checkMailboxTarget(target); err != nil {
+		return 0, err
+	}
+	caps, err := GetCapabilities()
+	if err != nil {
+		return 0, err
+	}
+	if kernelOlderThan(caps.Kernel, msgRingFlagsPassMinKernel) {
+		return 0, unsupported("MsgRingFlagsPass", msgRingFlagsPassMinKernel)
+	}
+
+	sqe := m.ring.GetSQE()
+	if sqe == nil {
+		return 0, ErrSQFull
+	}
+
+	sqe.PrepareMsgRingCqeFlags(target.ringFd, m.id, payload, 0, mailboxFlagsTag|uint32(kind)<<mailboxKindShift)
+
+	return m.finish(sqe, kind), nil
+}
+
+// msgRingFlagsPassMinKernel is the first kernel accepting MsgRingFlagsPass.
+var msgRingFlagsPassMinKernel = KernelVersion{Kernel: 6, Major: 3}
+
+func checkMailboxTarget(target *Ring) error {
+	if target.ringFd < 0 {
+		return fmt.Errorf("mailbox target without a ring file descriptor: %w", syscall.EBADF)
+	}
+
+	return nil
+}
+
+// PostDirect prepares a message which moves the direct descriptor at
+// sourceIndex of the mailbox ring to targetIndex of target, or to a free
+// slot with FileIndexAlloc. Both rings need registered file tables.
+func (m *Mailbox) PostDirect(target *Ring, sourceIndex int, targetIndex int, payload uint32) (uint64, error) {
+	if err := checkMailboxTarget(target); err != nil {
+		return 0, err
+	}
+
+	return m.postFd(target, MessageDirect, mailboxDirectTag, sourceIndex, targetIndex, payload)
+}
+
+func (m *Mailbox) postFd(
+	target *Ring, kind MessageKind, tag uint64, sourceIndex int, targetIndex int, payload uint32,
+) (uint64, error) {
+	sqe := m.ring.GetSQE()
+	if sqe == nil {
+		return 0, ErrSQFull
+	}
+
+	data := tag | uint64(m.id)<<mailboxFromShift | uint64(payload)
+	sqe.PrepareMsgRingFd(target.ringFd, sourceIndex, targetIndex, data, 0)
+
+	return m.finish(sqe, kind), nil
+}
+
+// finish tags the request with the sequence number of the message. Its
+// completion is not skipped with SqeCQESkipSuccess, which would disable
+// SqeIODrain on the ring for good.
+func (m *Mailbox) finish(sqe *SubmissionQueueEntry, kind MessageKind) uint64 {
+	m.seq++
+	sqe.UserData = mailboxSendTag | uint64(kind)<<mailboxSeqBits | m.seq&mailboxSeqMask
+
+	return m.seq
+}
+
+// Failed returns the delivery error reported by cqe, if it is the
+// completion of a message posted through a mailbox of the ring.
+func (m *Mailbox) Failed(cqe *CompletionQueueEvent) (*DeliveryError, bool) {
+	if cqe.UserData&mailboxTagMask != mailboxSendTag {
+		return nil, false
+	}
+	if cqe.Res >= 0 {
+		return nil, true
+	}
+
+	return &DeliveryError{
+		Seq:   cqe.UserData & mailboxSeqMask,
+		Kind:  MessageKind(cqe.UserData >> mailboxSeqBits & 0xff),
+		Errno: syscall.Errno(-cqe.Res),
+	}, true
+}
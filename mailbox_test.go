@@ -0,0 +1,200 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func TestMailbox(t *testing.T) {
+	sender, err := CreateRing(8)
+	NoError(t, err)
+
+	defer sender.QueueExit()
+
+	receiver, err := CreateRing(8)
+	NoError(t, err)
+
+	defer receiver.QueueExit()
+
+	_, err = sender.NewMailbox(1 << 24)
+	ErrorIs(t, err, syscall.EINVAL)
+
+	mailbox, err := sender.NewMailbox(7)
+	NoError(t, err)
+
+	file, err := os.Open(os.DevNull)
+	NoError(t, err)
+	defer file.Close()
+
+	_, err = sender.RegisterFilesSparse(2)
+	NoError(t, err)
+	_, err = receiver.RegisterFilesSparse(4)
+	NoError(t, err)
+
+	seq, err := mailbox.Post(receiver, 0xdeadbeefcafef00d)
+	NoError(t, err)
+	Equal(t, uint64(1), seq)
+	_, err = mailbox.PostFile(receiver, int(file.Fd()), 1, int(FileIndexAlloc), 42)
+	NoError(t, err)
+	_, err = mailbox.PostFile(receiver, -1, 1, int(FileIndexAlloc), 0)
+	ErrorIs(t, err, syscall.EBADF)
+	_, err = mailbox.Post(&Ring{ringFd: -1}, 1)
+	ErrorIs(t, err, syscall.EBADF)
+
+	_, err = sender.Submit()
+	NoError(t, err)
+
+	// The completions of the deliveries are consumed by the sender.
+	cqe, err := sender.PeekCQE()
+	ErrorIs(t, err, syscall.EAGAIN)
+	Nil(t, cqe)
+	Zero(t, sender.CQReady())
+
+	sqe := receiver.GetSQE()
+	sqe.PrepareNop()
+	sqe.UserData = 0xdeadbeefcafef00d
+	_, err = receiver.SubmitAndWait(3)
+	NoError(t, err)
+
+	var messages []Message
+	var others int
+	for cqe := range receiver.Completions() {
+		if msg, ok := ParseMessage(cqe); ok {
+			messages = append(messages, msg)
+		} else {
+			others++
+		}
+	}
+	Equal(t, 1, others)
+	Equal(t, []Message{
+		{Kind: MessageData, From: 7, Payload: 0xdeadbeefcafef00d},
+		{Kind: MessageFile, From: 7, Payload: 42, Fd: 0},
+	}, messages)
+}
+
+func TestMailboxDirect(t *testing.T) {
+	sender, err := CreateRing(8)
+	NoError(t, err)
+
+	defer sender.QueueExit()
+
+	receiver, err := CreateRing(8)
+	NoError(t, err)
+
+	defer receiver.QueueExit()
+
+	file, err := os.Open(os.DevNull)
+	NoError(t, err)
+	defer file.Close()
+
+	_, err = sender.RegisterFiles([]int{int(file.Fd())})
+	NoError(t, err)
+	_, err = receiver.RegisterFilesSparse(4)
+	NoError(t, err)
+
+	mailbox, err := sender.NewMailbox(3)
+	NoError(t, err)
+	_, err = mailbox.PostDirect(receiver, 0, int(FileIndexAlloc), 99)
+	NoError(t, err)
+	_, err = sender.Submit()
+	NoError(t, err)
+
+	cqe, err := receiver.WaitCQE()
+	NoError(t, err)
+	msg, ok := ParseMessage(cqe)
+	True(t, ok)
+	Equal(t, Message{Kind: MessageDirect, From: 3, Payload: 99, Fd: 0}, msg)
+	receiver.CQESeen(cqe)
+	_, err = sender.PeekCQE()
+	ErrorIs(t, err, syscall.EAGAIN)
+}
+
+func TestMailboxKeepsDrain(t *testing.T) {
+	sender, err := CreateRing(8)
+	NoError(t, err)
+
+	defer sender.QueueExit()
+
+	receiver, err := CreateRing(8)
+	NoError(t, err)
+
+	defer receiver.QueueExit()
+
+	mailbox, err := sender.NewMailbox(1)
+	NoError(t, err)
+	_, err = mailbox.Post(receiver, 5)
+	NoError(t, err)
+	_, err = sender.Submit()
+	NoError(t, err)
+
+	sqe := sender.GetSQE()
+	sqe.PrepareNop()
+	sqe.Flags |= SqeIODrain
+	sqe.UserData = 9
+	_, err = sender.SubmitAndWait(1)
+	NoError(t, err)
+
+	cqe, err := sender.WaitCQE()
+	NoError(t, err)
+	Equal(t, uint64(9), cqe.UserData)
+	Equal(t, int32(0), cqe.Res)
+	sender.CQESeen(cqe)
+}
+
+func TestMailboxDeliveryFailure(t *testing.T) {
+	sender, err := CreateRing(8)
+	NoError(t, err)
+
+	defer sender.QueueExit()
+
+	receiver, err := NewRingWithOptions(8, WithFlags(SetupRDisabled))
+	NoError(t, err)
+
+	defer receiver.QueueExit()
+
+	mailbox, err := sender.NewMailbox(1)
+	NoError(t, err)
+	seq, err := mailbox.Post(receiver, 5)
+	NoError(t, err)
+
+	_, err = sender.SubmitAndWait(1)
+	NoError(t, err)
+
+	cqe, err := sender.WaitCQE()
+	NoError(t, err)
+	failure, ok := mailbox.Failed(cqe)
+	True(t, ok)
+	Equal(t, seq, failure.Seq)
+	Equal(t, MessageData, failure.Kind)
+	ErrorIs(t, failure, syscall.EBADFD)
+	sender.CQESeen(cqe)
+
+	_, ok = mailbox.Failed(&CompletionQueueEvent{UserData: 5})
+	False(t, ok)
+}
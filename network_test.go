@@ -159,8 +159,9 @@ func (tester *networkTester) loop(
 		tester.accpepted++
 
 		Equal(t, uint64(socketFd), cqe.UserData^acceptFlag)
-		GreaterOrEqual(t, cqe.Res, int32(0))
-		fd := int(cqe.Res)
+		res, err := cqe.Result()
+		NoError(t, err)
+		fd := int(res)
 		conn := tester.getConnection(fd)
 
 		entry := ring.GetSQE()
@@ -199,6 +200,7 @@ func (tester *networkTester) loop(
 				recvLength = scenario.recvLengthProvider()
 			}
 
+			NoError(t, cqe.Err())
 			Equal(t, recvLength, cqe.Res)
 
 			dataRecevied := scenario.recvDataProvider(ctx, conn, cqe)
@@ -222,6 +224,7 @@ func (tester *networkTester) loop(
 
 		case cqe.UserData&sendFlag != 0:
 			Equal(t, uint64(conn.fd), cqe.UserData & ^allFlagsMask)
+			NoError(t, cqe.Err())
 			Greater(t, cqe.Res, int32(0))
 
 			if conn.receivedCount == expectedRWLoops {
@@ -238,6 +241,7 @@ func (tester *networkTester) loop(
 			}
 		case cqe.UserData&closeFlag != 0:
 			Equal(t, uint64(conn.fd), cqe.UserData & ^allFlagsMask)
+			NoError(t, cqe.Err())
 			Equal(t, int32(0), cqe.Res)
 
 			delete(tester.connections, conn.fd)
@@ -490,9 +494,8 @@ func TestMultiAcceptMultiRecvTCP(t *testing.T) {
 		},
 
 		recvDataProvider: func(ctx testContext, conn *tcpConn, cqe *CompletionQueueEvent) []byte {
-			NotZero(t, cqe.Flags&CQEFBuffer)
-
-			bufferIdx := uint16(cqe.Flags >> CQEBufferShift)
+			bufferIdx, ok := cqe.BufferID()
+			True(t, ok)
 			buffers, ok := ctx["buffers"].([][]byte)
 			True(t, ok)
 
@@ -558,9 +561,8 @@ func TestRecvMsgMultiSendTCP(t *testing.T) {
 		},
 
 		recvDataProvider: func(ctx testContext, conn *tcpConn, cqe *CompletionQueueEvent) []byte {
-			NotZero(t, cqe.Flags&CQEFBuffer)
-
-			bufferIdx := uint16(cqe.Flags >> CQEBufferShift)
+			bufferIdx, ok := cqe.BufferID()
+			True(t, ok)
 			buffers, ok := ctx["buffers"].([][]byte)
 			True(t, ok)
 
@@ -663,8 +665,9 @@ func TestMultiAcceptMultiRecvMultiDirectBufRingTCP(t *testing.T) {
 		},
 
 		recvDataProvider: func(ctx testContext, conn *tcpConn, cqe *CompletionQueueEvent) []byte {
-			NotZero(t, cqe.Flags&CQEFBuffer)
-			bufferIdx := int(cqe.Flags >> CQEBufferShift)
+			bufferID, ok := cqe.BufferID()
+			True(t, ok)
+			bufferIdx := int(bufferID)
 			bufferBase, ok := ctx["bufferBase"].(uintptr)
 			True(t, ok)
 			bufRing, ok := ctx["bufRing"].(*BufAndRing)
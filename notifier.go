@@ -0,0 +1,171 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"context"
+	"errors"
+	"os"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Notifier lets goroutines wait for completions of a ring in the Go
+// runtime poller instead of blocking a thread in io_uring_enter. The kernel
+// signals an eventfd registered with the ring whenever completions are
+// posted, and the eventfd is polled like any other non-blocking file.
+//
+// The ring is still single threaded: Wait, Drain and Run must not be
+// called concurrently with other uses of the ring.
+type Notifier struct {
+	ring *Ring
+	fd   int
+	file *os.File
+	conn syscall.RawConn
+}
+
+// NewNotifier registers a new eventfd with the ring. With async set it is
+// registered with RegisterEventFdAsync and only signalled for requests
+// which completed asynchronously.
+func (ring *Ring) NewNotifier(async bool) (*Notifier, error) {
+	fd, err := unix.Eventfd(0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC)
+	if err != nil {
+		return nil, os.NewSyscallError("eventfd", err)
+	}
+
+	if async {
+		_, err = ring.RegisterEventFdAsync(fd)
+	} else {
+		_, err = ring.RegisterEventFd(fd)
+	}
+	if err != nil {
+		_ = unix.Close(fd)
+
+		return nil, err
+	}
+
+	file := os.NewFile(uintptr(fd), "io_uring-eventfd")
+	conn, err := file.SyscallConn()
+	if err != nil {
+		_, _ = ring.UnregisterEventFd(fd)
+		_ = file.Close()
+
+		return nil, err
+	}
+
+	return &Notifier{ring: ring, fd: fd, file: file, conn: conn}, nil
+}
+
+// Wait parks the goroutine until the eventfd is signalled or ctx is done.
+// Completions which are already in the CQ do not signal it again, so call
+// Drain before waiting.
+func (n *Notifier) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	expired := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		defer close(expired)
+		_ = n.file.SetReadDeadline(time.Now())
+	})
+	defer func() {
+		if !stop() {
+			<-expired
+			_ = n.file.SetReadDeadline(time.Time{})
+		}
+	}()
+
+	var value [8]byte
+	var readErr error
+
+	err := n.conn.Read(func(fd uintptr) bool {
+		_, readErr = unix.Read(int(fd), value[:])
+
+		return !errors.Is(readErr, unix.EAGAIN)
+	})
+	if errors.Is(err, os.ErrDeadlineExceeded) && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	if readErr != nil {
+		return os.NewSyscallError("read", readErr)
+	}
+
+	return nil
+}
+
+// Drain passes every available completion to handler and marks it seen.
+// The eventfd is disabled while draining so the completions being handled
+// do not cause spurious wakeups. It returns the number of completions.
+func (n *Notifier) Drain(handler func(cqe *CompletionQueueEvent)) int {
+	ring := n.ring
+	toggled := ring.CqEventfdToggle(false) == nil
+
+	var count int
+	for {
+		if ring.flags&SetupDeferTaskrun != 0 {
+			_, _ = ring.GetEvents()
+		}
+		for cqe := range ring.Completions() {
+			handler(cqe)
+			count++
+		}
+
+		if !toggled {
+			return count
+		}
+		_ = ring.CqEventfdToggle(true)
+
+		// Completions posted while the eventfd was disabled did not
+		// signal it.
+		if ring.CQReady() == 0 && !ring.cqRingNeedsFlush() {
+			return count
+		}
+		_ = ring.CqEventfdToggle(false)
+	}
+}
+
+// Run waits for completions and drains them until ctx is done, which makes
+// it return ctx.Err().
+func (n *Notifier) Run(ctx context.Context, handler func(cqe *CompletionQueueEvent)) error {
+	for {
+		n.Drain(handler)
+
+		if err := n.Wait(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// Close unregisters and closes the eventfd.
+func (n *Notifier) Close() error {
+	_, err := n.ring.UnregisterEventFd(n.fd)
+
+	return errors.Join(err, n.file.Close())
+}
@@ -0,0 +1,119 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+	"unsafe"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func TestCqEventfdToggle(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	True(t, ring.CQEventfdEnabled())
+	NoError(t, ring.CqEventfdToggle(false))
+	False(t, ring.CQEventfdEnabled())
+	NoError(t, ring.CqEventfdToggle(true))
+	True(t, ring.CQEventfdEnabled())
+}
+
+func TestNotifierWait(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	notifier, err := ring.NewNotifier(false)
+	NoError(t, err)
+
+	reader, writer, err := os.Pipe()
+	NoError(t, err)
+	defer reader.Close()
+	defer writer.Close()
+
+	buf := make([]byte, 8)
+	sqe := ring.GetSQE()
+	sqe.PrepareRead(int(reader.Fd()), uintptr(unsafe.Pointer(&buf[0])), uint32(len(buf)), 0)
+	sqe.UserData = 1
+	_, err = ring.Submit()
+	NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	ErrorIs(t, notifier.Wait(ctx), context.DeadlineExceeded)
+
+	time.AfterFunc(10*time.Millisecond, func() { _, _ = writer.Write([]byte("ping")) })
+	NoError(t, notifier.Wait(context.Background()))
+
+	var results []int32
+	Equal(t, 1, notifier.Drain(func(cqe *CompletionQueueEvent) {
+		results = append(results, cqe.Res)
+	}))
+	Equal(t, []int32{4}, results)
+	True(t, ring.CQEventfdEnabled())
+
+	NoError(t, notifier.Close())
+}
+
+func TestNotifierRun(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	for _, flags := range []uint32{0, SetupSingleIssuer | SetupDeferTaskrun} {
+		ring, err := NewRingWithOptions(8, WithFlags(flags))
+		NoError(t, err)
+
+		notifier, err := ring.NewNotifier(false)
+		NoError(t, err)
+
+		for i := 0; i < 4; i++ {
+			ring.GetSQE().PrepareNop()
+		}
+		_, err = ring.Submit()
+		NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var count int
+		err = notifier.Run(ctx, func(*CompletionQueueEvent) {
+			count++
+			if count == 4 {
+				cancel()
+			}
+		})
+		ErrorIs(t, err, context.Canceled)
+		Equal(t, 4, count)
+
+		NoError(t, notifier.Close())
+		ring.QueueExit()
+	}
+}
@@ -0,0 +1,163 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"errors"
+)
+
+// ErrOpPending is returned by Op.Result before the operation completed.
+var ErrOpPending = errors.New("operation pending")
+
+// Op is a request submitted through a SharedRing which completes in the
+// future.
+type Op struct {
+	shared *SharedRing
+	id     uint64
+	done   chan struct{}
+	stream chan CompletionQueueEvent
+
+	// Written by the reaper before done is closed.
+	cqe CompletionQueueEvent
+	err error
+}
+
+// Submit stages a request prepared by prep and returns its Op. The user
+// data is assigned by the shared ring.
+func (s *SharedRing) Submit(prep func(sqe *SubmissionQueueEntry)) *Op {
+	return s.submitOp(prep, nil)
+}
+
+// SubmitMultishot is Submit for multishot requests. Every completion
+// carrying CQEFMore is sent to Op.Stream, which is buffered with buffer
+// entries; the reaper blocks while it is full. The stream is closed when
+// the final completion arrives.
+func (s *SharedRing) SubmitMultishot(prep func(sqe *SubmissionQueueEntry), buffer int) *Op {
+	return s.submitOp(prep, make(chan CompletionQueueEvent, buffer))
+}
+
+func (s *SharedRing) submitOp(prep func(sqe *SubmissionQueueEntry), stream chan CompletionQueueEvent) *Op {
+	op := &Op{
+		shared: s,
+		done:   make(chan struct{}),
+		stream: stream,
+	}
+
+	id, err := s.SubmitCallback(prep, op.complete)
+	op.id = id
+	if err != nil {
+		op.err = err
+		op.finish()
+	}
+
+	return op
+}
+
+func (op *Op) complete(cqe *CompletionQueueEvent) {
+	if cqe.IsNotification() {
+		// The zero copy notification ends the request; keep the result of
+		// the first completion.
+		op.cqe.Flags = op.cqe.Flags&^CQEFMore | CQEFNotif
+	} else {
+		op.cqe = *cqe
+	}
+	if cqe.More() {
+		if op.stream != nil {
+			op.stream <- *cqe
+		}
+
+		return
+	}
+	op.err = op.cqe.Err()
+	op.finish()
+}
+
+func (op *Op) finish() {
+	if op.stream != nil {
+		close(op.stream)
+	}
+	close(op.done)
+}
+
+// ID returns the user data of the request.
+func (op *Op) ID() uint64 {
+	return op.id
+}
+
+// Done returns a channel which is closed when the operation completed.
+func (op *Op) Done() <-chan struct{} {
+	return op.done
+}
+
+// Stream returns the channel of the intermediate completions of a
+// multishot operation, or nil for operations created with Submit.
+func (op *Op) Stream() <-chan CompletionQueueEvent {
+	return op.stream
+}
+
+// Wait blocks until the operation completed and returns its result.
+func (op *Op) Wait() (int32, error) {
+	<-op.done
+
+	return op.Result()
+}
+
+// Result returns the result of the final completion, or an error wrapping
+// its errno. It returns ErrOpPending if the operation did not complete yet.
+func (op *Op) Result() (int32, error) {
+	select {
+	case <-op.done:
+	default:
+		return 0, ErrOpPending
+	}
+
+	if op.err != nil {
+		return op.cqe.Res, op.err
+	}
+
+	return op.cqe.Res, nil
+}
+
+// Flags returns the flags of the final completion, or 0 while the
+// operation is pending.
+func (op *Op) Flags() uint32 {
+	select {
+	case <-op.done:
+		return op.cqe.Flags
+	default:
+		return 0
+	}
+}
+
+// Cancel requests cancellation of the operation. The operation still
+// completes, usually with ECANCELED.
+func (op *Op) Cancel() error {
+	select {
+	case <-op.done:
+		return nil
+	default:
+	}
+
+	return op.shared.Cancel(op.id)
+}
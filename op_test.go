@@ -0,0 +1,137 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func TestOpWait(t *testing.T) {
+	shared, err := NewSharedRing(8)
+	NoError(t, err)
+
+	defer shared.Close()
+
+	op := shared.Submit(func(sqe *SubmissionQueueEntry) { sqe.PrepareNop() })
+	res, err := op.Wait()
+	NoError(t, err)
+	Equal(t, int32(0), res)
+	NotZero(t, op.ID())
+	Nil(t, op.Stream())
+
+	buf := make([]byte, 8)
+	op = shared.Submit(func(sqe *SubmissionQueueEntry) {
+		sqe.PrepareRead(-1, uintptr(unsafe.Pointer(&buf[0])), uint32(len(buf)), 0)
+	})
+	<-op.Done()
+	_, err = op.Result()
+	ErrorIs(t, err, syscall.EBADF)
+
+	var cqeErr *CQEError
+	ErrorAs(t, err, &cqeErr)
+	Equal(t, op.ID(), cqeErr.UserData)
+}
+
+func TestOpCancel(t *testing.T) {
+	shared, err := NewSharedRing(8)
+	NoError(t, err)
+
+	defer shared.Close()
+
+	reader, writer, err := os.Pipe()
+	NoError(t, err)
+	defer reader.Close()
+	defer writer.Close()
+
+	buf := make([]byte, 8)
+	op := shared.Submit(func(sqe *SubmissionQueueEntry) {
+		sqe.PrepareRead(int(reader.Fd()), uintptr(unsafe.Pointer(&buf[0])), uint32(len(buf)), 0)
+	})
+
+	_, err = op.Result()
+	ErrorIs(t, err, ErrOpPending)
+	Zero(t, op.Flags())
+
+	NoError(t, op.Cancel())
+	_, err = op.Wait()
+	ErrorIs(t, err, syscall.ECANCELED)
+	NoError(t, op.Cancel())
+}
+
+func TestOpMultishot(t *testing.T) {
+	shared, err := NewSharedRing(8)
+	NoError(t, err)
+
+	defer shared.Close()
+
+	fd, err := unix.Eventfd(0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC)
+	NoError(t, err)
+	defer unix.Close(fd)
+
+	op := shared.SubmitMultishot(func(sqe *SubmissionQueueEntry) {
+		sqe.PreparePollMultishot(fd, unix.POLLIN)
+	}, 4)
+
+	var value [8]byte
+	value[0] = 1
+	for i := 0; i < 3; i++ {
+		_, err = unix.Write(fd, value[:])
+		NoError(t, err)
+
+		select {
+		case cqe := <-op.Stream():
+			True(t, cqe.More())
+			Equal(t, op.ID(), cqe.UserData)
+		case <-time.After(time.Second):
+			t.Fatal("no multishot completion")
+		}
+		_, _ = unix.Read(fd, value[:])
+		value[0] = 1
+	}
+
+	NoError(t, op.Cancel())
+	_, err = op.Wait()
+	ErrorIs(t, err, syscall.ECANCELED)
+
+	_, ok := <-op.Stream()
+	False(t, ok)
+}
+
+func TestOpClosedRing(t *testing.T) {
+	shared, err := NewSharedRing(8)
+	NoError(t, err)
+	NoError(t, shared.Close())
+
+	op := shared.Submit(func(sqe *SubmissionQueueEntry) { sqe.PrepareNop() })
+	_, err = op.Wait()
+	ErrorIs(t, err, ErrRingClosed)
+}
@@ -0,0 +1,207 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// RingOption configures the Params used by NewRingWithOptions.
+type RingOption func(*ringOptions)
+
+type ringOptions struct {
+	params Params
+	parent *Ring
+	err    error
+}
+
+// WithSQPoll enables a kernel submission queue polling thread. If cpu is not
+// negative, the thread is pinned to that CPU. The thread goes to sleep after
+// being idle for the given duration, rounded up to whole milliseconds; zero
+// selects the kernel default of one second.
+func WithSQPoll(cpu int, idle time.Duration) RingOption {
+	return func(opts *ringOptions) {
+		if idle < 0 {
+			opts.fail("negative SQPOLL idle time: %w", syscall.EINVAL)
+
+			return
+		}
+		opts.params.flags |= SetupSQPoll
+		opts.params.sqThreadIdle = uint32((idle + time.Millisecond - 1) / time.Millisecond)
+		if cpu >= 0 {
+			opts.params.flags |= SetupSQAff
+			opts.params.sqThreadCPU = uint32(cpu)
+		}
+	}
+}
+
+// WithCQSize sets the number of completion queue entries instead of the
+// default of twice the submission queue entries.
+func WithCQSize(entries uint32) RingOption {
+	return func(opts *ringOptions) {
+		if entries == 0 {
+			opts.fail("zero CQ size: %w", syscall.EINVAL)
+
+			return
+		}
+		opts.params.flags |= SetupCQSize
+		opts.params.cqEntries = entries
+	}
+}
+
+// WithAttachWQ makes the ring share the async worker backend of parent. The
+// parent is kept alive until the ring exits, see NewAttachedRing.
+func WithAttachWQ(parent *Ring) RingOption {
+	return func(opts *ringOptions) {
+		if parent == nil || parent.ringFd < 0 {
+			opts.fail("SetupAttachWQ requires a parent ring with a valid fd: %w", syscall.EBADF)
+
+			return
+		}
+		opts.params.flags |= SetupAttachWQ
+		opts.params.wqFd = uint32(parent.ringFd)
+		opts.parent = parent
+	}
+}
+
+// WithFlags adds raw Setup* flags to the ring setup flags.
+func WithFlags(flags uint32) RingOption {
+	return func(opts *ringOptions) {
+		opts.params.flags |= flags
+	}
+}
+
+func (opts *ringOptions) fail(format string, args ...interface{}) {
+	if opts.err == nil {
+		opts.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (opts *ringOptions) validate(entries uint32) error {
+	if opts.err != nil {
+		return opts.err
+	}
+
+	flags := opts.params.flags
+
+	switch {
+	case entries == 0:
+		return fmt.Errorf("zero SQ entries: %w", syscall.EINVAL)
+	case flags&SetupSQAff != 0 && flags&SetupSQPoll == 0:
+		return fmt.Errorf("SetupSQAff requires SetupSQPoll: %w", syscall.EINVAL)
+	case flags&SetupAttachWQ != 0 && opts.parent == nil:
+		return fmt.Errorf("SetupAttachWQ requires WithAttachWQ: %w", syscall.EINVAL)
+	case flags&SetupCQSize != 0 && opts.params.cqEntries == 0:
+		return fmt.Errorf("SetupCQSize requires WithCQSize: %w", syscall.EINVAL)
+	case flags&SetupCQSize != 0 && flags&SetupClamp == 0 && opts.params.cqEntries < entries:
+		return fmt.Errorf("CQ size %d is smaller than SQ size %d: %w", opts.params.cqEntries, entries, syscall.EINVAL)
+	case flags&SetupSQPoll != 0 && flags&(SetupCoopTaskrun|SetupTaskrunFlag|SetupDeferTaskrun) != 0:
+		return fmt.Errorf("task run flags cannot be combined with SetupSQPoll: %w", syscall.EINVAL)
+	case flags&SetupTaskrunFlag != 0 && flags&(SetupCoopTaskrun|SetupDeferTaskrun) == 0:
+		return fmt.Errorf("SetupTaskrunFlag requires SetupCoopTaskrun or SetupDeferTaskrun: %w", syscall.EINVAL)
+	case flags&SetupDeferTaskrun != 0 && flags&SetupSingleIssuer == 0:
+		return fmt.Errorf("SetupDeferTaskrun requires SetupSingleIssuer: %w", syscall.EINVAL)
+	case flags&SetupRegisteredFdOnly != 0 && flags&SetupNoMmap == 0:
+		return fmt.Errorf("SetupRegisteredFdOnly requires SetupNoMmap: %w", syscall.EINVAL)
+	}
+
+	return nil
+}
+
+// NewRingWithOptions creates a ring with the given number of submission queue
+// entries. The options are checked for conflicting combinations before the
+// ring is set up. Negotiated sizes and features are available from
+// Ring.Params afterwards.
+func NewRingWithOptions(entries uint32, options ...RingOption) (*Ring, error) {
+	opts := &ringOptions{}
+	for _, option := range options {
+		option(opts)
+	}
+
+	err := opts.validate(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	ring := NewRing()
+
+	if opts.parent != nil {
+		err = ring.attachTo(opts.parent)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = ring.QueueInitParams(entries, &opts.params)
+	if err != nil {
+		ring.detachFromParent()
+
+		return nil, err
+	}
+
+	return ring, nil
+}
+
+// Params returns a copy of the parameters negotiated with the kernel during
+// ring setup.
+func (ring *Ring) Params() Params {
+	return ring.params
+}
+
+// SQEntries returns the number of submission queue entries.
+func (p Params) SQEntries() uint32 {
+	return p.sqEntries
+}
+
+// CQEntries returns the number of completion queue entries.
+func (p Params) CQEntries() uint32 {
+	return p.cqEntries
+}
+
+// Flags returns the Setup* flags.
+func (p Params) Flags() uint32 {
+	return p.flags
+}
+
+// Features returns the Feat* flags reported by the kernel.
+func (p Params) Features() uint32 {
+	return p.features
+}
+
+// SQThreadCPU returns the CPU of the SQPOLL thread.
+func (p Params) SQThreadCPU() uint32 {
+	return p.sqThreadCPU
+}
+
+// SQThreadIdle returns the SQPOLL thread idle time.
+func (p Params) SQThreadIdle() time.Duration {
+	return time.Duration(p.sqThreadIdle) * time.Millisecond
+}
+
+// WQFd returns the fd of the ring whose async backend is shared.
+func (p Params) WQFd() uint32 {
+	return p.wqFd
+}
@@ -0,0 +1,100 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func TestNewRingWithOptions(t *testing.T) {
+	ring, err := NewRingWithOptions(8, WithCQSize(64), WithFlags(SetupClamp))
+	NoError(t, err)
+	NotNil(t, ring)
+
+	defer ring.QueueExit()
+
+	params := ring.Params()
+	Equal(t, uint32(8), params.SQEntries())
+	Equal(t, uint32(64), params.CQEntries())
+	Equal(t, SetupCQSize|SetupClamp, params.Flags())
+	NotZero(t, params.Features()&FeatSingleMMap)
+
+	NoError(t, queueNOPs(t, ring, 4, 0))
+	_, err = ring.WaitCQENr(4)
+	NoError(t, err)
+	Equal(t, uint32(4), ring.CQReady())
+	ring.CQAdvance(4)
+}
+
+func TestNewRingWithOptionsAttachWQ(t *testing.T) {
+	parent, err := NewRingWithOptions(4)
+	NoError(t, err)
+
+	defer parent.QueueExit()
+
+	child, err := NewRingWithOptions(4, WithAttachWQ(parent))
+	NoError(t, err)
+
+	defer child.QueueExit()
+
+	params := child.Params()
+	Equal(t, uint32(parent.RingFd()), params.WQFd())
+	NotZero(t, params.Flags()&SetupAttachWQ)
+}
+
+func TestNewRingWithOptionsSQPollIdle(t *testing.T) {
+	ring, err := NewRingWithOptions(4, WithSQPoll(-1, 500*time.Microsecond))
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	Equal(t, time.Millisecond, ring.Params().SQThreadIdle())
+	Equal(t, uint32(4), ring.Params().SQEntries())
+}
+
+func TestNewRingWithOptionsInvalid(t *testing.T) {
+	for _, options := range [][]RingOption{
+		{WithFlags(SetupSQAff)},
+		{WithCQSize(2)},
+		{WithCQSize(0)},
+		{WithFlags(SetupAttachWQ)},
+		{WithSQPoll(-1, time.Second), WithFlags(SetupCoopTaskrun)},
+		{WithSQPoll(-1, -time.Second)},
+		{WithFlags(SetupTaskrunFlag)},
+		{WithFlags(SetupDeferTaskrun)},
+		{WithFlags(SetupRegisteredFdOnly)},
+	} {
+		ring, err := NewRingWithOptions(8, options...)
+		ErrorIs(t, err, syscall.EINVAL)
+		Nil(t, ring)
+	}
+
+	ring, err := NewRingWithOptions(8, WithAttachWQ(nil))
+	ErrorIs(t, err, syscall.EBADF)
+	Nil(t, ring)
+}
@@ -0,0 +1,252 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// RingPool runs one event loop per CPU. Every loop is a goroutine locked to
+// its own thread and pinned to a CPU, which owns a ring created with
+// SetupSingleIssuer and SetupDeferTaskrun. Work is sent to the loops as
+// functions which run on the loop thread.
+//
+// The loops never submit or reap on their own: the functions sent to them
+// do. Since the rings use SetupDeferTaskrun, completions of requests left in
+// flight by one function are only posted when a later one enters the ring
+// to wait for them, with WaitCQE, SubmitAndWait or GetEvents for example.
+type RingPool struct {
+	loops  []*poolLoop
+	next   atomic.Uint64
+	closed atomic.Bool
+	active atomic.Int64
+	quit   chan struct{}
+	wg     sync.WaitGroup
+}
+
+type poolLoop struct {
+	cpu  int
+	tid  int
+	ring *Ring
+	work chan func(ring *Ring)
+	err  error
+}
+
+// poolQueueSize is the number of functions which can be queued to a loop
+// before Send blocks.
+const poolQueueSize = 64
+
+// NewRingPool starts n event loops, one per CPU of the affinity mask of the
+// calling thread; n of 0 starts one loop per such CPU. The rings have the
+// given entries and options, with SetupSingleIssuer and SetupDeferTaskrun
+// added.
+func NewRingPool(n int, entries uint32, options ...RingOption) (*RingPool, error) {
+	var set unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &set); err != nil {
+		return nil, err
+	}
+
+	cpus := make([]int, 0, set.Count())
+	for cpu := 0; len(cpus) < set.Count(); cpu++ {
+		if set.IsSet(cpu) {
+			cpus = append(cpus, cpu)
+		}
+	}
+
+	if n < 0 {
+		return nil, fmt.Errorf("ring pool of %d loops: %w", n, syscall.EINVAL)
+	}
+	if n == 0 {
+		n = len(cpus)
+	}
+
+	options = append(options[:len(options):len(options)], WithFlags(SetupSingleIssuer|SetupDeferTaskrun))
+
+	pool := &RingPool{
+		loops: make([]*poolLoop, n),
+		quit:  make(chan struct{}),
+	}
+	started := make(chan *poolLoop, n)
+
+	for i := range pool.loops {
+		loop := &poolLoop{
+			cpu:  cpus[i%len(cpus)],
+			work: make(chan func(ring *Ring), poolQueueSize),
+		}
+		pool.loops[i] = loop
+		pool.wg.Add(1)
+		go pool.run(loop, entries, options, started)
+	}
+
+	var err error
+	for range pool.loops {
+		if loop := <-started; loop.err != nil {
+			err = errors.Join(err, loop.err)
+		}
+	}
+	if err != nil {
+		_ = pool.Close()
+
+		return nil, err
+	}
+
+	return pool, nil
+}
+
+func (p *RingPool) run(loop *poolLoop, entries uint32, options []RingOption, started chan<- *poolLoop) {
+	defer p.wg.Done()
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var set unix.CPUSet
+	set.Set(loop.cpu)
+	loop.err = unix.SchedSetaffinity(0, &set)
+	if loop.err == nil {
+		loop.tid = unix.Gettid()
+		loop.ring, loop.err = NewRingWithOptions(entries, options...)
+	}
+	if loop.err != nil {
+		loop.err = fmt.Errorf("ring pool loop on CPU %d: %w", loop.cpu, loop.err)
+		started <- loop
+		p.drain(loop, func(func(ring *Ring)) {})
+
+		return
+	}
+	started <- loop
+
+	for {
+		select {
+		case fn := <-loop.work:
+			fn(loop.ring)
+		case <-p.quit:
+			p.drain(loop, func(fn func(ring *Ring)) { fn(loop.ring) })
+			_ = loop.ring.Close()
+
+			return
+		}
+	}
+}
+
+// drain handles the functions queued to the loop until the pool is closed
+// and no Send is in progress.
+func (p *RingPool) drain(loop *poolLoop, handle func(fn func(ring *Ring))) {
+	<-p.quit
+
+	for {
+		select {
+		case fn := <-loop.work:
+			handle(fn)
+		default:
+			if p.active.Load() == 0 && len(loop.work) == 0 {
+				return
+			}
+			runtime.Gosched()
+		}
+	}
+}
+
+// Len returns the number of loops.
+func (p *RingPool) Len() int {
+	return len(p.loops)
+}
+
+// CPU returns the CPU loop i is pinned to.
+func (p *RingPool) CPU(i int) int {
+	return p.loops[i].cpu
+}
+
+// Send queues fn to run on the thread of loop i with its ring. The ring
+// must not be used outside of such functions: the kernel rejects entering
+// it from another thread with EEXIST, which IssuerError turns into
+// ErrNotIssuer. Send blocks
+// while the queue of the loop is full, so functions must not send to their
+// own loop.
+func (p *RingPool) Send(i int, fn func(ring *Ring)) error {
+	if i < 0 || i >= len(p.loops) {
+		return fmt.Errorf("ring pool loop %d: %w", i, syscall.EINVAL)
+	}
+
+	p.active.Add(1)
+	defer p.active.Add(-1)
+
+	if p.closed.Load() {
+		return ErrRingClosed
+	}
+	if unix.Gettid() == p.loops[i].tid {
+		return fmt.Errorf("send to ring pool loop %d from its own thread: %w", i, syscall.EDEADLK)
+	}
+	p.loops[i].work <- fn
+
+	return nil
+}
+
+// SendAny queues fn to the loops in round robin order and returns the index
+// of the chosen loop.
+func (p *RingPool) SendAny(fn func(ring *Ring)) (int, error) {
+	i := int(p.next.Add(1)-1) % len(p.loops)
+
+	return i, p.Send(i, fn)
+}
+
+// ErrNotIssuer is returned by IssuerError when the ring of a loop was
+// entered from a thread other than the loop thread.
+var ErrNotIssuer = fmt.Errorf("ring used from a thread which is not its single issuer: %w", syscall.EEXIST)
+
+// IssuerError returns ErrNotIssuer if err is the EEXIST the kernel returns
+// when ring, which must belong to one of the loops, is entered from a thread
+// other than the loop thread. Other errors are returned unchanged.
+func (p *RingPool) IssuerError(ring *Ring, err error) error {
+	if !errors.Is(err, syscall.EEXIST) {
+		return err
+	}
+
+	tid := unix.Gettid()
+	for _, loop := range p.loops {
+		if loop.ring == ring && loop.tid != tid {
+			return ErrNotIssuer
+		}
+	}
+
+	return err
+}
+
+// Close stops the loops after they ran the queued functions and closes
+// their rings. Send fails with ErrRingClosed afterwards.
+func (p *RingPool) Close() error {
+	if !p.closed.CompareAndSwap(false, true) {
+		return ErrRingClosed
+	}
+	close(p.quit)
+	p.wg.Wait()
+
+	return nil
+}
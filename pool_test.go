@@ -0,0 +1,159 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func TestRingPool(t *testing.T) {
+	pool, err := NewRingPool(2, 8)
+	NoError(t, err)
+
+	Equal(t, 2, pool.Len())
+
+	for i := 0; i < pool.Len(); i++ {
+		done := make(chan error, 1)
+		NoError(t, pool.Send(i, func(ring *Ring) {
+			var set unix.CPUSet
+			if err := unix.SchedGetaffinity(0, &set); err != nil {
+				done <- err
+
+				return
+			}
+			if set.Count() != 1 || !set.IsSet(pool.CPU(i)) {
+				done <- syscall.EINVAL
+
+				return
+			}
+			if !SetupFlags(ring.flags).Has(SetupSingleIssuer | SetupDeferTaskrun) {
+				done <- syscall.EINVAL
+
+				return
+			}
+
+			ring.GetSQE().PrepareNop()
+			_, err := ring.SubmitAndWait(1)
+			ring.CQAdvance(ring.CQReady())
+			done <- err
+		}))
+		NoError(t, <-done)
+	}
+
+	indexes := make([]int, 0, 4)
+	for i := 0; i < 4; i++ {
+		index, err := pool.SendAny(func(*Ring) {})
+		NoError(t, err)
+		indexes = append(indexes, index)
+	}
+	Equal(t, []int{0, 1, 0, 1}, indexes)
+
+	ErrorIs(t, pool.Send(2, func(*Ring) {}), syscall.EINVAL)
+
+	NoError(t, pool.Close())
+	ErrorIs(t, pool.Close(), ErrRingClosed)
+	ErrorIs(t, pool.Send(0, func(*Ring) {}), ErrRingClosed)
+}
+
+func TestRingPoolNotIssuer(t *testing.T) {
+	pool, err := NewRingPool(1, 8)
+	NoError(t, err)
+
+	defer pool.Close()
+
+	rings := make(chan *Ring, 1)
+	NoError(t, pool.Send(0, func(ring *Ring) { rings <- ring }))
+	ring := <-rings
+
+	// The test goroutine runs on a different thread than the loop.
+	ring.GetSQE().PrepareNop()
+	_, err = ring.Submit()
+	Equal(t, syscall.EEXIST, err)
+	err = pool.IssuerError(ring, err)
+	ErrorIs(t, err, ErrNotIssuer)
+	ErrorIs(t, err, syscall.EEXIST)
+	Equal(t, syscall.EINVAL, pool.IssuerError(ring, syscall.EINVAL))
+
+	errs := make(chan error, 1)
+	NoError(t, pool.Send(0, func(ring *Ring) {
+		errs <- pool.IssuerError(ring, syscall.EEXIST)
+	}))
+	Equal(t, syscall.EEXIST, <-errs)
+
+	NoError(t, pool.Send(0, func(*Ring) {
+		errs <- pool.Send(0, func(*Ring) {})
+	}))
+	ErrorIs(t, <-errs, syscall.EDEADLK)
+}
+
+func TestRingPoolReapInLaterSend(t *testing.T) {
+	pool, err := NewRingPool(1, 8)
+	NoError(t, err)
+
+	defer pool.Close()
+
+	var fds [2]int
+	NoError(t, syscall.Pipe(fds[:]))
+	defer syscall.Close(fds[0])
+	defer syscall.Close(fds[1])
+
+	buf := make([]byte, 1)
+	errs := make(chan error, 1)
+
+	// The read stays in flight after the first function returns.
+	NoError(t, pool.Send(0, func(ring *Ring) {
+		sqe := ring.GetSQE()
+		sqe.PrepareRead(fds[0], uintptr(unsafe.Pointer(&buf[0])), 1, 0)
+		sqe.UserData = 1
+		_, err := ring.Submit()
+		errs <- err
+	}))
+	NoError(t, <-errs)
+
+	_, err = syscall.Write(fds[1], []byte{'x'})
+	NoError(t, err)
+
+	// A later function reaps its completion.
+	results := make(chan int32, 1)
+	NoError(t, pool.Send(0, func(ring *Ring) {
+		cqe, err := ring.WaitCQE()
+		if err != nil {
+			errs <- err
+
+			return
+		}
+		results <- cqe.Res
+		ring.CQESeen(cqe)
+		errs <- nil
+	}))
+	NoError(t, <-errs)
+	Equal(t, int32(1), <-results)
+	Equal(t, byte('x'), buf[0])
+}
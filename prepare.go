@@ -45,10 +45,13 @@ func (entry *SubmissionQueueEntry) prepareRW(opcode uint8, fd int, addr uintptr,
 	entry.Off = offset
 	entry.Addr = uint64(addr)
 	entry.Len = length
+	entry.OpcodeFlags = 0
 	entry.UserData = 0
 	entry.BufIG = 0
 	entry.Personality = 0
 	entry.SpliceFdIn = 0
+	entry.Addr3 = 0
+	entry._pad2[0] = 0
 }
 
 // liburing: io_uring_prep_accept - https://manpages.debian.org/unstable/liburing-dev/io_uring_prep_accept.3.en.html
@@ -198,7 +201,7 @@ func (entry *SubmissionQueueEntry) PrepareMsgRingCqeFlags(fd int, length uint32,
 
 // liburing: io_uring_prep_msg_ring_fd - https://manpages.debian.org/unstable/liburing-dev/io_uring_prep_msg_ring_fd.3.en.html
 func (entry *SubmissionQueueEntry) PrepareMsgRingFd(fd int, sourceFd int, targetFd int, data uint64, flags uint32) {
-	entry.prepareRW(OpMsgRing, fd, uintptr(unsafe.Pointer(&msgDataVar)), 0, data)
+	entry.prepareRW(OpMsgRing, fd, uintptr(MsgSendFd), 0, data)
 	entry.Addr3 = uint64(sourceFd)
 	if uint32(targetFd) == FileIndexAlloc {
 		targetFd--
@@ -583,15 +586,13 @@ const bit32Offset = 32
 
 // liburing: io_uring_prep_cmd_sock
 func (entry *SubmissionQueueEntry) PrepareCmdSock(
-	cmdOp int, fd int, _ int, _ int, _ unsafe.Pointer, _ int,
+	cmdOp int, fd int, level int, optname int, optval unsafe.Pointer, optlen int,
 ) {
-	// This will be removed once the get/setsockopt() patches land
-	// var unused uintptr
-	// unused = uintptr(optlen)
-	// unused = uintptr(optval)
-	// unused = uintptr(level)
-	// unused = uintptr(optname)
-	// io_uring_prep_rw(IORING_OP_URING_CMD, sqe, fd, nil, 0, 0)
 	entry.prepareRW(OpUringCmd, fd, 0, 0, 0)
-	entry.Off = uint64(cmdOp << bit32Offset)
+	// cmd_op occupies the low half of off, level and optname share addr,
+	// optlen shares splice_fd_in and optval shares addr3.
+	entry.Off = uint64(uint32(cmdOp))
+	entry.Addr = uint64(uint32(level)) | uint64(uint32(optname))<<bit32Offset
+	entry.SpliceFdIn = int32(optlen)
+	entry.Addr3 = uint64(uintptr(optval))
 }
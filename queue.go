@@ -184,21 +184,29 @@ func (ring *Ring) PeekBatchCQE(cqes []*CompletionQueueEvent) uint32 {
 	count := uint32(len(cqes))
 
 again:
+	ring.skipInternalCQEs()
 	ready = ring.CQReady()
 	if ready != 0 {
 		head := *ring.cqRing.head
 		mask := *ring.cqRing.ringMask
-		last := head + count
 		if count > ready {
 			count = ready
 		}
-		for i := 0; head != last; head, i = head+1, i+1 {
-			cqes[i] = (*CompletionQueueEvent)(
+		// The batch ends before an internal completion of the context
+		// aware waits or of a mailbox, so that it can be marked as seen
+		// with CQAdvance.
+		for i := uint32(0); i < count; head, i = head+1, i+1 {
+			cqe := (*CompletionQueueEvent)(
 				unsafe.Add(
 					unsafe.Pointer(ring.cqRing.cqes),
 					uintptr((head&mask)<<shift)*unsafe.Sizeof(CompletionQueueEvent{}),
 				),
 			)
+			if ring.isInternalCQE(cqe) {
+				count = i
+			} else {
+				cqes[i] = cqe
+			}
 		}
 
 		return count
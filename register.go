@@ -27,6 +27,7 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"sync/atomic"
 	"syscall"
 	"unsafe"
 
@@ -172,7 +173,7 @@ func (ring *Ring) RegisterFilesSparse(nr uint32) (uint, error) {
 
 	for {
 		ret, errno = ring.doRegisterErrno(RegisterFiles2, unsafe.Pointer(reg), uint32(unsafe.Sizeof(*reg)))
-		if errno != 0 {
+		if errno == 0 {
 			break
 		}
 
@@ -186,6 +187,7 @@ func (ring *Ring) RegisterFilesSparse(nr uint32) (uint, error) {
 
 			continue
 		}
+		err = os.NewSyscallError("io_uring_register", errno)
 
 		break
 	}
@@ -211,7 +213,7 @@ func (ring *Ring) RegisterFilesTags(files []int, tags []uint64) (uint, error) {
 
 	for {
 		ret, errno = ring.doRegisterErrno(RegisterFiles2, unsafe.Pointer(reg), uint32(unsafe.Sizeof(*reg)))
-		if ret > 0 {
+		if errno == 0 {
 			break
 		}
 		if errno == syscall.EMFILE && !didIncrease {
@@ -223,6 +225,7 @@ func (ring *Ring) RegisterFilesTags(files []int, tags []uint64) (uint, error) {
 
 			continue
 		}
+		err = os.NewSyscallError("io_uring_register", errno)
 
 		break
 	}
@@ -241,7 +244,7 @@ func (ring *Ring) RegisterFiles(files []int) (uint, error) {
 
 	for {
 		ret, errno = ring.doRegisterErrno(RegisterFiles, unsafe.Pointer(&files[0]), uint32(len(files)))
-		if ret > 0 {
+		if errno == 0 {
 			break
 		}
 		if errno == syscall.EMFILE && !didIncrease {
@@ -253,6 +256,7 @@ func (ring *Ring) RegisterFiles(files []int) (uint, error) {
 
 			continue
 		}
+		err = os.NewSyscallError("io_uring_register", errno)
 
 		break
 	}
@@ -271,8 +275,11 @@ func (ring *Ring) RegisterEventFd(fd int) (uint, error) {
 }
 
 // liburing: io_uring_unregister_eventfd - https://manpages.debian.org/unstable/liburing-dev/io_uring_unregister_eventfd.3.en.html
-func (ring *Ring) UnregisterEventFd(fd int) (uint, error) {
-	return ring.doRegister(UnregisterEventFD, unsafe.Pointer(&fd), 1)
+//
+// The kernel unregisters the registered eventfd whatever fd is; it is kept
+// for compatibility.
+func (ring *Ring) UnregisterEventFd(_ int) (uint, error) {
+	return ring.doRegister(UnregisterEventFD, nil, 0)
 }
 
 // liburing: io_uring_register_eventfd_async - https://manpages.debian.org/unstable/liburing-dev/io_uring_register_eventfd_async.3.en.html
@@ -368,7 +375,7 @@ func (ring *Ring) UnregisterRingFd() (uint, error) {
 		Offset: uint32(ring.enterRingFd),
 	}
 
-	if (ring.intFlags & IntFlagRegRing) != 0 {
+	if (ring.intFlags & IntFlagRegRing) == 0 {
 		return 0, syscall.EINVAL
 	}
 
@@ -429,6 +436,21 @@ func (ring *Ring) RegisterSyncCancel(reg *SyncCancelReg) (uint, error) {
 	return ring.doRegister(RegisterSyncCancel, unsafe.Pointer(reg), 1)
 }
 
+// liburing: io_uring_register_clock
+func (ring *Ring) RegisterClock(reg *ClockRegister) (uint, error) {
+	result, err := ring.doRegister(RegisterClock, unsafe.Pointer(reg), 0)
+	if err == nil {
+		ring.clockID = int32(reg.ClockID)
+	}
+
+	return result, err
+}
+
+// liburing: io_uring_register_region
+func (ring *Ring) RegisterRegion(reg *MemRegionReg) (uint, error) {
+	return ring.doRegister(RegisterMemRegion, unsafe.Pointer(reg), 1)
+}
+
 // liburing: io_uring_register_file_alloc_range - https://manpages.debian.org/unstable/liburing-dev/io_uring_register_file_alloc_range.3.en.html
 func (ring *Ring) RegisterFileAllocRange(off, length uint32) (uint, error) {
 	fileRange := &FileIndexRange{
@@ -441,3 +463,67 @@ func (ring *Ring) RegisterFileAllocRange(off, length uint32) (uint, error) {
 
 	return result, err
 }
+
+// liburing: io_uring_resize_rings
+func (ring *Ring) ResizeRings(p *Params) error {
+	if ring.flags&SetupNoMmap != 0 {
+		return syscall.EINVAL
+	}
+	if ring.ringFd < 0 {
+		return syscall.EBADF
+	}
+
+	// Entries which are only in the local SQ copy would not be carried over
+	// by the kernel.
+	ring.internalFlushSQ()
+
+	p.sqOff = SQRingOffsets{}
+	p.cqOff = CQRingOffsets{}
+	_, err := ring.doRegister(RegisterResizeRings, unsafe.Pointer(p), 1)
+	runtime.KeepAlive(p)
+	if err != nil {
+		return err
+	}
+
+	sq := ring.sqRing
+	cq := ring.cqRing
+
+	_ = sysMunmap(uintptr(unsafe.Pointer(sq.sqes)), uintptr(sq.sqesSize))
+	UnmapRings(sq, cq)
+	*sq = SubmissionQueue{}
+	*cq = CompletionQueue{}
+
+	params := ring.params
+	params.sqEntries = p.sqEntries
+	params.cqEntries = p.cqEntries
+	params.sqOff = p.sqOff
+	params.cqOff = p.cqOff
+	if params.sqOff.array == 0 {
+		// The kernel does not report the SQ array offset on resize. It
+		// follows the CQEs, aligned to a cache line.
+		cqeSize := unsafe.Sizeof(CompletionQueueEvent{})
+		if ring.flags&SetupCQE32 != 0 {
+			cqeSize += unsafe.Sizeof(CompletionQueueEvent{})
+		}
+		array := uintptr(params.cqOff.cqes) + uintptr(params.cqEntries)*cqeSize
+		params.sqOff.array = uint32((array + ringSizeCQOff) &^ ringSizeCQOff)
+	}
+
+	err = Mmap(ring.ringFd, &params, sq, cq)
+	if err != nil {
+		return err
+	}
+
+	// Everything was flushed above, so the local copy restarts at the tail
+	// the kernel carried over.
+	sq.sqeHead = atomic.LoadUint32(sq.tail)
+	sq.sqeTail = sq.sqeHead
+	for index := uint32(0); index < params.sqEntries; index++ {
+		*(*uint32)(
+			unsafe.Add(unsafe.Pointer(sq.array),
+				index*uint32(unsafe.Sizeof(uint32(0))))) = index
+	}
+	ring.params = params
+
+	return nil
+}
@@ -0,0 +1,66 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// Resize changes the number of submission and completion queue entries of a
+// live ring. Registered files and buffers, pending submissions and unreaped
+// completions are kept. A cqEntries of zero selects twice sqEntries. The
+// ring has to be created with SetupDeferTaskrun and must not use
+// SetupNoMmap. On kernels without support an *UnsupportedError is returned.
+//
+// The kernel fails with EOVERFLOW if the pending submissions or completions
+// do not fit in the new queues. SQEs and CQEs obtained before the call must
+// not be used afterwards.
+func (ring *Ring) Resize(sqEntries, cqEntries uint32) error {
+	caps, err := GetCapabilities()
+	if err != nil {
+		return err
+	}
+	err = caps.SupportsRegister(RegisterResizeRings)
+	if err != nil {
+		return err
+	}
+
+	if ring.flags&SetupDeferTaskrun == 0 {
+		return fmt.Errorf("resizing requires SetupDeferTaskrun: %w", syscall.EINVAL)
+	}
+	if ring.flags&SetupNoMmap != 0 {
+		return fmt.Errorf("rings created with SetupNoMmap cannot be resized: %w", syscall.EINVAL)
+	}
+
+	params := &Params{
+		sqEntries: sqEntries,
+	}
+	if cqEntries != 0 {
+		params.flags = SetupCQSize
+		params.cqEntries = cqEntries
+	}
+
+	return ring.ResizeRings(params)
+}
@@ -0,0 +1,92 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func TestResize(t *testing.T) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	ring, err := NewRingWithOptions(4, WithFlags(SetupSingleIssuer|SetupDeferTaskrun))
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	_, err = ring.RegisterFiles([]int{int(os.Stdin.Fd())})
+	NoError(t, err)
+
+	// Two completions are left unreaped and one submission is unflushed.
+	NoError(t, queueNOPs(t, ring, 2, 0))
+	_, err = ring.WaitCQENr(2)
+	NoError(t, err)
+	sqe := ring.GetSQE()
+	NotNil(t, sqe)
+	sqe.PrepareNop()
+	sqe.UserData = 2
+
+	NoError(t, ring.Resize(16, 64))
+
+	params := ring.Params()
+	Equal(t, uint32(16), params.SQEntries())
+	Equal(t, uint32(64), params.CQEntries())
+	Equal(t, uint32(2), ring.CQReady())
+	Equal(t, uint32(1), ring.SQReady())
+
+	_, err = ring.SubmitAndWait(3)
+	NoError(t, err)
+	Equal(t, uint32(3), ring.CQReady())
+	ring.CQAdvance(3)
+
+	// The registered file table survived the resize.
+	_, err = ring.RegisterFilesUpdate(0, []int{int(os.Stdin.Fd())})
+	NoError(t, err)
+
+	NoError(t, queueNOPs(t, ring, 16, 0))
+	_, err = ring.WaitCQENr(16)
+	NoError(t, err)
+	Equal(t, uint32(16), ring.CQReady())
+	ring.CQAdvance(16)
+
+	NoError(t, ring.Resize(8, 0))
+	params = ring.Params()
+	Equal(t, uint32(8), params.SQEntries())
+	Equal(t, uint32(16), params.CQEntries())
+}
+
+func TestResizeRequiresDeferTaskrun(t *testing.T) {
+	ring, err := NewRingWithOptions(4)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	ErrorIs(t, ring.Resize(8, 16), syscall.EINVAL)
+}
@@ -0,0 +1,162 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"fmt"
+	"math"
+	"syscall"
+)
+
+// RestrictionSet builds the list of restrictions applied to a ring with
+// RegisterRestrictions. Anything not allowed explicitly is rejected by the
+// kernel with EACCES once the ring is enabled.
+type RestrictionSet struct {
+	ops          []uint8
+	registerOps  []uint32
+	allowedFlags uint8
+	requireFlags uint8
+	flagsSet     bool
+}
+
+// NewRestrictionSet returns an empty set which allows nothing.
+func NewRestrictionSet() *RestrictionSet {
+	return &RestrictionSet{}
+}
+
+// AllowOp allows submitting SQEs with the given Op* opcodes.
+func (s *RestrictionSet) AllowOp(ops ...uint8) *RestrictionSet {
+	for _, op := range ops {
+		if !containsOp(s.ops, op) {
+			s.ops = append(s.ops, op)
+		}
+	}
+
+	return s
+}
+
+// AllowRegister allows the given Register* opcodes.
+func (s *RestrictionSet) AllowRegister(ops ...uint32) *RestrictionSet {
+	for _, op := range ops {
+		if !containsOp(s.registerOps, op) {
+			s.registerOps = append(s.registerOps, op)
+		}
+	}
+
+	return s
+}
+
+// AllowSQEFlags allows SQEs to carry the given Sqe* flags. Flags from
+// repeated calls are combined.
+func (s *RestrictionSet) AllowSQEFlags(flags uint8) *RestrictionSet {
+	s.allowedFlags |= flags
+	s.flagsSet = true
+
+	return s
+}
+
+// RequireSQEFlags requires every SQE to carry the given Sqe* flags. Flags
+// from repeated calls are combined.
+func (s *RestrictionSet) RequireSQEFlags(flags uint8) *RestrictionSet {
+	s.requireFlags |= flags
+	s.flagsSet = true
+
+	return s
+}
+
+// Restrictions returns the set as the entries passed to
+// RegisterRestrictions.
+func (s *RestrictionSet) Restrictions() ([]Restriction, error) {
+	restrictions := make([]Restriction, 0, len(s.ops)+len(s.registerOps)+2)
+
+	for _, op := range s.registerOps {
+		if op > math.MaxUint8 {
+			return nil, fmt.Errorf("register opcode %d cannot be restricted: %w", op, syscall.EINVAL)
+		}
+		restrictions = append(restrictions, Restriction{
+			OpCode:  uint16(RestrictionRegisterOp),
+			OpFlags: uint8(op),
+		})
+	}
+	for _, op := range s.ops {
+		restrictions = append(restrictions, Restriction{
+			OpCode:  uint16(RestrictionSQEOp),
+			OpFlags: op,
+		})
+	}
+	if s.flagsSet {
+		restrictions = append(restrictions,
+			Restriction{
+				OpCode:  uint16(RestrictionSQEFlagsAllowed),
+				OpFlags: s.allowedFlags | s.requireFlags,
+			},
+			Restriction{
+				OpCode:  uint16(RestrictionSQEFlagsRequired),
+				OpFlags: s.requireFlags,
+			})
+	}
+
+	if len(restrictions) == 0 {
+		return nil, fmt.Errorf("empty restriction set: %w", syscall.EINVAL)
+	}
+
+	return restrictions, nil
+}
+
+func containsOp[T uint8 | uint32](ops []T, op T) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewRestrictedRing creates a ring which may only be used as allowed by set.
+// The ring is created disabled, the restrictions are registered and the ring
+// is enabled. With SetupSingleIssuer the calling thread becomes the issuer.
+func NewRestrictedRing(entries uint32, set *RestrictionSet, options ...RingOption) (*Ring, error) {
+	restrictions, err := set.Restrictions()
+	if err != nil {
+		return nil, err
+	}
+
+	ring, err := NewRingWithOptions(entries, append(options, WithFlags(SetupRDisabled))...)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = ring.RegisterRestrictions(restrictions)
+	if err == nil {
+		_, err = ring.EnableRings()
+	}
+	if err != nil {
+		ring.QueueExit()
+
+		return nil, err
+	}
+
+	return ring, nil
+}
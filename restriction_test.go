@@ -0,0 +1,95 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func TestRestrictionSet(t *testing.T) {
+	restrictions, err := NewRestrictionSet().
+		AllowOp(OpNop, OpRead, OpNop).
+		AllowRegister(RegisterFiles).
+		AllowSQEFlags(SqeIOLink).
+		AllowSQEFlags(SqeAsync).
+		RequireSQEFlags(SqeFixedFile).
+		Restrictions()
+	NoError(t, err)
+	Equal(t, []Restriction{
+		{OpCode: uint16(RestrictionRegisterOp), OpFlags: uint8(RegisterFiles)},
+		{OpCode: uint16(RestrictionSQEOp), OpFlags: OpNop},
+		{OpCode: uint16(RestrictionSQEOp), OpFlags: OpRead},
+		{OpCode: uint16(RestrictionSQEFlagsAllowed), OpFlags: SqeIOLink | SqeAsync | SqeFixedFile},
+		{OpCode: uint16(RestrictionSQEFlagsRequired), OpFlags: SqeFixedFile},
+	}, restrictions)
+
+	_, err = NewRestrictionSet().Restrictions()
+	ErrorIs(t, err, syscall.EINVAL)
+	_, err = NewRestrictionSet().AllowRegister(RegisterUseRegisteredRing).Restrictions()
+	ErrorIs(t, err, syscall.EINVAL)
+}
+
+func TestNewRestrictedRing(t *testing.T) {
+	ring, err := NewRestrictedRing(8, NewRestrictionSet().AllowOp(OpNop).AllowRegister(RegisterProbe),
+		WithFlags(SetupSubmitAll))
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	_, err = ring.GetProbeRing()
+	NoError(t, err)
+	_, err = ring.RegisterFiles([]int{int(os.Stdin.Fd())})
+	ErrorIs(t, err, syscall.EACCES)
+
+	sqe := ring.GetSQE()
+	sqe.PrepareNop()
+	sqe.UserData = 1
+	sqe = ring.GetSQE()
+	sqe.PrepareNop()
+	sqe.Flags |= SqeAsync
+	sqe.UserData = 2
+	sqe = ring.GetSQE()
+	sqe.PrepareRead(int(os.Stdin.Fd()), 0, 0, 0)
+	sqe.UserData = 3
+
+	_, err = ring.SubmitAndWait(3)
+	NoError(t, err)
+
+	results := make(map[uint64]int32)
+	for ring.CQReady() > 0 {
+		cqe, err := ring.PeekCQE()
+		NoError(t, err)
+		results[cqe.UserData] = cqe.Res
+		ring.CQESeen(cqe)
+	}
+	Equal(t, map[uint64]int32{
+		1: 0,
+		2: -int32(syscall.EACCES),
+		3: -int32(syscall.EACCES),
+	}, results)
+}
@@ -23,6 +23,8 @@
 
 package giouring
 
+import "golang.org/x/sys/unix"
+
 const (
 	IntFlagRegRing    uint8 = 1
 	IntFlagRegRegRing uint8 = 2
@@ -31,8 +33,9 @@ const (
 
 func NewRing() *Ring {
 	return &Ring{
-		sqRing: &SubmissionQueue{},
-		cqRing: &CompletionQueue{},
+		sqRing:  &SubmissionQueue{},
+		cqRing:  &CompletionQueue{},
+		clockID: unix.CLOCK_MONOTONIC,
 	}
 }
 
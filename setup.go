@@ -40,7 +40,7 @@ func fls(x int) int {
 		return 0
 	}
 
-	return 8*int(unsafe.Sizeof(x)) - bits.LeadingZeros32(uint32(x))
+	return bits.Len32(uint32(x))
 }
 
 func roundupPow2(depth uint32) uint32 {
@@ -173,6 +173,7 @@ func Mmap(fd int, p *Params, sq *SubmissionQueue, cq *CompletionQueue) error {
 		goto err
 	}
 	sq.sqes = (*SubmissionQueueEntry)(unsafe.Pointer(ringPtr))
+	sq.sqesSize = uint(size * uintptr(p.sqEntries))
 	SetupRingPointers(p, sq, cq)
 
 	return nil
@@ -224,9 +225,6 @@ func (ring *Ring) RingDontFork() error {
 	return nil
 }
 
-/* FIXME */
-const hugePageSize uint64 = 2 * 1024 * 1024
-
 // liburing: io_uring_alloc_huge
 func allocHuge(
 	entries uint32, p *Params, sq *SubmissionQueue, cq *CompletionQueue, buf unsafe.Pointer, bufSize uint64,
@@ -235,76 +233,57 @@ func allocHuge(
 	var sqEntries, cqEntries uint32
 	var ringMem, sqesMem uint64
 	var memUsed uint64
-	var ptr unsafe.Pointer
 
 	errno := getSqCqEntries(entries, p, &sqEntries, &cqEntries)
 	if errno != nil {
 		return 0, errno
 	}
 
-	sqesMem = uint64(sqEntries) * uint64(unsafe.Sizeof(SubmissionQueue{}))
-	sqesMem = (sqesMem + pageSize - 1) &^ (pageSize - 1)
-	ringMem = uint64(cqEntries) * uint64(unsafe.Sizeof(CompletionQueue{}))
-	if p.flags&SetupCQE32 != 0 {
-		ringMem *= 2
-	}
-	ringMem += uint64(sqEntries) * uint64(unsafe.Sizeof(uint32(0)))
-	memUsed = sqesMem + ringMem
-	memUsed = (memUsed + pageSize - 1) &^ (pageSize - 1)
+	sqesMem, ringMem = ringMemSizes(sqEntries, cqEntries, p.flags)
+	sqesMem = alignUp(sqesMem, pageSize)
+	memUsed = alignUp(sqesMem+ringMem, pageSize)
 
-	if buf == nil && (sqesMem > hugePageSize || ringMem > hugePageSize) {
-		return 0, syscall.ENOMEM
-	}
+	sq.ringSize = 0
+	cq.ringSize = 0
+	sq.sqesSize = 0
 
 	if buf != nil {
 		if memUsed > bufSize {
 			return 0, syscall.ENOMEM
 		}
-		ptr = buf
+		sq.sqes = (*SubmissionQueueEntry)(buf)
+		sq.ringPtr = unsafe.Add(buf, sqesMem)
 	} else {
-		var mapHugetlb int
-		if sqesMem <= pageSize {
-			bufSize = pageSize
-		} else {
-			bufSize = hugePageSize
-			mapHugetlb = syscall.MAP_HUGETLB
-		}
-		var err error
-		ptr, err = sysMmap(
-			0, uintptr(bufSize),
-			syscall.PROT_READ|syscall.PROT_WRITE,
-			syscall.MAP_SHARED|syscall.MAP_ANONYMOUS|mapHugetlb, -1, 0)
+		ptr, mapped, huge, err := mapRingMem(memUsed)
 		if err != nil {
 			return 0, err
 		}
-	}
 
-	sq.sqes = (*SubmissionQueueEntry)(ptr)
-	if memUsed <= bufSize {
-		sq.ringPtr = unsafe.Pointer(uintptr(unsafe.Pointer(sq.sqes)) + uintptr(sqesMem))
-		cq.ringSize = 0
-		sq.ringSize = 0
-	} else {
-		var mapHugetlb int
-		if ringMem <= pageSize {
-			bufSize = pageSize
+		if huge || mapped == pageSize {
+			sq.sqes = (*SubmissionQueueEntry)(ptr)
+			sq.sqesSize = uint(mapped)
+			sq.ringPtr = unsafe.Add(ptr, sqesMem)
 		} else {
-			bufSize = hugePageSize
-			mapHugetlb = syscall.MAP_HUGETLB
-		}
-		var err error
-		ptr, err = sysMmap(
-			0, uintptr(bufSize),
-			syscall.PROT_READ|syscall.PROT_WRITE,
-			syscall.MAP_SHARED|syscall.MAP_ANONYMOUS|mapHugetlb, -1, 0)
-		if err != nil {
-			_ = sysMunmap(uintptr(unsafe.Pointer(sq.sqes)), 1)
+			// Without a huge page, keep the SQEs and the rings in separate
+			// mappings so each of them may still fit in a single page.
+			_ = sysMunmap(uintptr(ptr), uintptr(mapped))
 
-			return 0, err
+			ptr, mapped, _, err = mapRingMem(sqesMem)
+			if err != nil {
+				return 0, err
+			}
+			sq.sqes = (*SubmissionQueueEntry)(ptr)
+			sq.sqesSize = uint(mapped)
+
+			ptr, mapped, _, err = mapRingMem(ringMem)
+			if err != nil {
+				_ = sysMunmap(uintptr(unsafe.Pointer(sq.sqes)), uintptr(sq.sqesSize))
+
+				return 0, err
+			}
+			sq.ringPtr = ptr
+			sq.ringSize = uint(mapped)
 		}
-		sq.ringPtr = ptr
-		sq.ringSize = uint(bufSize)
-		cq.ringSize = 0
 	}
 
 	cq.ringPtr = sq.ringPtr
@@ -337,7 +316,7 @@ func (ring *Ring) internalQueueInitParams(entries uint32, p *Params, buf unsafe.
 	fdPtr, _, errno := syscall.Syscall(sysSetup, uintptr(entries), uintptr(unsafe.Pointer(p)), 0)
 	if errno != 0 {
 		if p.flags&SetupNoMmap != 0 && ring.intFlags&IntFlagAppMem == 0 {
-			_ = sysMunmap(uintptr(unsafe.Pointer(ring.sqRing.sqes)), 1)
+			_ = sysMunmap(uintptr(unsafe.Pointer(ring.sqRing.sqes)), uintptr(ring.sqRing.sqesSize))
 			UnmapRings(ring.sqRing, ring.cqRing)
 		}
 
@@ -365,6 +344,7 @@ func (ring *Ring) internalQueueInitParams(entries uint32, p *Params, buf unsafe.
 
 	ring.features = p.features
 	ring.flags = p.flags
+	ring.params = *p
 	ring.enterRingFd = fd
 	if p.flags&SetupRegisteredFdOnly != 0 {
 		ring.ringFd = -1
@@ -372,6 +352,7 @@ func (ring *Ring) internalQueueInitParams(entries uint32, p *Params, buf unsafe.
 	} else {
 		ring.ringFd = fd
 	}
+	ring.trackLeak()
 
 	return nil
 }
@@ -400,19 +381,19 @@ func (ring *Ring) QueueInit(entries uint32, flags uint32) error {
 
 // liburing: io_uring_queue_exit - https://manpages.debian.org/unstable/liburing-dev/io_uring_queue_exit.3.en.html
 func (ring *Ring) QueueExit() {
+	if !ring.beginExit() {
+		return
+	}
+	ring.queueExit()
+}
+
+func (ring *Ring) queueExit() {
 	sq := ring.sqRing
 	cq := ring.cqRing
-	var sqeSize uintptr
 
-	if sq.ringSize == 0 {
-		sqeSize = unsafe.Sizeof(SubmissionQueueEntry{})
-		if ring.flags&SetupSQE128 != 0 {
-			sqeSize += 64
-		}
-		_ = sysMunmap(uintptr(unsafe.Pointer(sq.sqes)), sqeSize*uintptr(*sq.ringEntries))
-		UnmapRings(sq, cq)
-	} else if ring.intFlags&IntFlagAppMem == 0 {
-		_ = sysMunmap(uintptr(unsafe.Pointer(sq.sqes)), uintptr(*sq.ringEntries)*unsafe.Sizeof(SubmissionQueueEntry{}))
+	// Memory supplied through QueueInitMem belongs to the caller.
+	if ring.intFlags&IntFlagAppMem == 0 {
+		_ = sysMunmap(uintptr(unsafe.Pointer(sq.sqes)), uintptr(sq.sqesSize))
 		UnmapRings(sq, cq)
 	}
 
@@ -422,6 +403,14 @@ func (ring *Ring) QueueExit() {
 	if ring.ringFd != -1 {
 		syscall.Close(ring.ringFd)
 	}
+
+	if ring.waitRegion != nil {
+		ring.waitRegion.free()
+		ring.waitRegion = nil
+	}
+	ring.closeContextWaker()
+	ring.untrackLeak()
+	ring.detachFromParent()
 }
 
 const ringSize = 320
@@ -534,6 +523,11 @@ func (ring *Ring) brSetup(nentries uint32, bgid uint16, flags uint32) (*BufAndRi
 		return nil, err
 	}
 
+	if ring.bufRings == nil {
+		ring.bufRings = make(map[uint16]bufRingMem)
+	}
+	ring.bufRings[bgid] = bufRingMem{ptr: brPtr, size: ringSize}
+
 	return br, nil
 }
 
@@ -550,8 +544,17 @@ func (ring *Ring) SetupBufRing(nentries uint32, bgid int, flags uint32) (*BufAnd
 // liburing: io_uring_free_buf_ring - https://manpages.debian.org/unstable/liburing-dev/io_uring_free_buf_ring.3.en.html
 func (ring *Ring) FreeBufRing(bgid int) error {
 	_, err := ring.UnregisterBufferRing(bgid)
+	if err != nil {
+		return err
+	}
 
-	return err
+	if mem, ok := ring.bufRings[uint16(bgid)]; ok {
+		delete(ring.bufRings, uint16(bgid))
+
+		return sysMunmap(mem.ptr, mem.size)
+	}
+
+	return nil
 }
 
 func (ring *Ring) RingFd() int {
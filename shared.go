@@ -0,0 +1,422 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// User data of the internal requests of a SharedRing.
+const (
+	sharedWakeUserData   = liburingUdataTimeout - 4
+	sharedCancelUserData = liburingUdataTimeout - 5
+)
+
+// sharedRequest is a submission staged by a goroutine for the reaper of a
+// SharedRing.
+type sharedRequest struct {
+	next     atomic.Pointer[sharedRequest]
+	id       uint64
+	prep     func(sqe *SubmissionQueueEntry)
+	callback func(cqe *CompletionQueueEvent)
+	cancel   bool
+}
+
+// mpscQueue is an intrusive lock-free queue with many producers and a
+// single consumer.
+type mpscQueue struct {
+	head atomic.Pointer[sharedRequest]
+	tail *sharedRequest
+	stub sharedRequest
+}
+
+func (q *mpscQueue) init() {
+	q.head.Store(&q.stub)
+	q.tail = &q.stub
+}
+
+func (q *mpscQueue) push(req *sharedRequest) {
+	req.next.Store(nil)
+	prev := q.head.Swap(req)
+	prev.next.Store(req)
+}
+
+// pop returns nil when the queue is empty or when a producer has not
+// finished linking its request yet.
+func (q *mpscQueue) pop() *sharedRequest {
+	tail := q.tail
+	next := tail.next.Load()
+
+	if tail == &q.stub {
+		if next == nil {
+			return nil
+		}
+		q.tail = next
+		tail = next
+		next = next.next.Load()
+	}
+	if next != nil {
+		q.tail = next
+
+		return tail
+	}
+	if tail != q.head.Load() {
+		return nil
+	}
+
+	q.push(&q.stub)
+	next = tail.next.Load()
+	if next != nil {
+		q.tail = next
+
+		return tail
+	}
+
+	return nil
+}
+
+func (q *mpscQueue) empty() bool {
+	return q.tail.next.Load() == nil && q.head.Load() == q.tail
+}
+
+// SharedRing is a Ring which many goroutines can submit through. Requests
+// are staged in a lock-free queue and submitted by a reaper goroutine which
+// owns the ring and routes every completion back to its submitter.
+//
+// The reaper assigns the user data of the requests. Requests can not be
+// linked, since entries of different goroutines are interleaved.
+type SharedRing struct {
+	ring     *Ring
+	queue    mpscQueue
+	wakeFd   int
+	sleeping atomic.Bool
+	closing  atomic.Bool
+	active   atomic.Int64
+	nextID   atomic.Uint64
+	done     chan struct{}
+	err      error
+
+	// Owned by the reaper goroutine.
+	inflight map[uint64]func(cqe *CompletionQueueEvent)
+	backlog  []*sharedRequest
+	armed    bool
+}
+
+// NewSharedRing creates a ring owned by a new reaper goroutine. The
+// goroutine is locked to its thread, so SetupSingleIssuer and
+// SetupDeferTaskrun can be used.
+func NewSharedRing(entries uint32, options ...RingOption) (*SharedRing, error) {
+	fd, err := unix.Eventfd(0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+
+	shared := &SharedRing{
+		wakeFd:   fd,
+		done:     make(chan struct{}),
+		inflight: make(map[uint64]func(cqe *CompletionQueueEvent)),
+	}
+	shared.queue.init()
+
+	ready := make(chan error, 1)
+	go shared.run(entries, options, ready)
+
+	if err = <-ready; err != nil {
+		_ = unix.Close(fd)
+
+		return nil, err
+	}
+
+	return shared, nil
+}
+
+// SubmitCallback stages a request prepared by prep and returns its ID.
+// callback is called from the reaper goroutine with every completion of the
+// request, so it must not block; the completion is only valid during the
+// call. Multishot requests get a callback for each completion.
+func (s *SharedRing) SubmitCallback(
+	prep func(sqe *SubmissionQueueEntry), callback func(cqe *CompletionQueueEvent),
+) (uint64, error) {
+	req := &sharedRequest{
+		id:       s.nextID.Add(1),
+		prep:     prep,
+		callback: callback,
+	}
+
+	return req.id, s.stage(req)
+}
+
+// SubmitChan is SubmitCallback which sends a copy of every completion to
+// ch. The reaper blocks while ch is full, so it should be buffered.
+func (s *SharedRing) SubmitChan(
+	prep func(sqe *SubmissionQueueEntry), ch chan<- CompletionQueueEvent,
+) (uint64, error) {
+	return s.SubmitCallback(prep, func(cqe *CompletionQueueEvent) {
+		ch <- *cqe
+	})
+}
+
+// Cancel requests cancellation of the request with the given ID.
+func (s *SharedRing) Cancel(id uint64) error {
+	return s.stage(&sharedRequest{id: id, cancel: true})
+}
+
+// Close stops the reaper after cancelling the requests in flight, whose
+// callbacks still get their completions, and exits the ring.
+func (s *SharedRing) Close() error {
+	if !s.closing.CompareAndSwap(false, true) {
+		return ErrRingClosed
+	}
+	s.wake()
+	<-s.done
+
+	return s.err
+}
+
+func (s *SharedRing) stage(req *sharedRequest) error {
+	s.active.Add(1)
+	defer s.active.Add(-1)
+
+	if s.closing.Load() {
+		return ErrRingClosed
+	}
+	s.queue.push(req)
+	s.wake()
+
+	return nil
+}
+
+func (s *SharedRing) wake() {
+	if s.sleeping.Load() && s.sleeping.CompareAndSwap(true, false) {
+		var value [8]byte
+		value[0] = 1
+		_, _ = unix.Write(s.wakeFd, value[:])
+	}
+}
+
+func (s *SharedRing) run(entries uint32, options []RingOption, ready chan<- error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer close(s.done)
+
+	ring, err := NewRingWithOptions(entries, options...)
+	ready <- err
+	if err != nil {
+		return
+	}
+	s.ring = ring
+
+	err = s.loop()
+	s.closing.Store(true)
+	for s.active.Load() != 0 {
+		runtime.Gosched()
+	}
+
+	s.shutdown(time.Now().Add(DefaultCloseTimeout))
+	closeErr := ring.Close()
+	s.failAll()
+	_ = unix.Close(s.wakeFd)
+
+	s.err = errors.Join(err, closeErr)
+}
+
+func (s *SharedRing) loop() error {
+	for {
+		if err := s.submitStaged(); err != nil {
+			return err
+		}
+
+		s.sleeping.Store(true)
+		if s.closing.Load() {
+			s.sleeping.Store(false)
+
+			return nil
+		}
+
+		var err error
+		if s.armed && s.queue.empty() && len(s.backlog) == 0 {
+			_, err = s.ring.SubmitAndWait(1)
+		} else {
+			s.sleeping.Store(false)
+			_, err = s.ring.SubmitAndGetEvents()
+		}
+		s.sleeping.Store(false)
+
+		if err != nil && !sharedTemporary(err) {
+			return err
+		}
+		s.reap()
+	}
+}
+
+func sharedTemporary(err error) bool {
+	return errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN) ||
+		errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.ETIME)
+}
+
+// getSQE returns a free entry, submitting the staged ones if the SQ is full.
+func (s *SharedRing) getSQE() (*SubmissionQueueEntry, error) {
+	sqe := s.ring.GetSQE()
+	if sqe != nil {
+		return sqe, nil
+	}
+
+	_, err := s.ring.Submit()
+	if err != nil && !sharedTemporary(err) {
+		return nil, err
+	}
+
+	return s.ring.GetSQE(), nil
+}
+
+func (s *SharedRing) submitStaged() error {
+	if !s.armed {
+		sqe, err := s.getSQE()
+		if err != nil || sqe == nil {
+			return err
+		}
+		sqe.PreparePollMultishot(s.wakeFd, unix.POLLIN)
+		sqe.UserData = sharedWakeUserData
+		s.armed = true
+	}
+
+	for {
+		var req *sharedRequest
+		if len(s.backlog) > 0 {
+			req = s.backlog[0]
+		} else if req = s.queue.pop(); req == nil {
+			return nil
+		}
+
+		sqe, err := s.getSQE()
+		if err != nil {
+			return err
+		}
+		if sqe == nil {
+			if len(s.backlog) == 0 {
+				s.backlog = append(s.backlog, req)
+			}
+
+			return nil
+		}
+		if len(s.backlog) > 0 {
+			s.backlog[0] = nil
+			s.backlog = s.backlog[1:]
+		}
+
+		if req.cancel {
+			sqe.PrepareCancel64(req.id, 0)
+			sqe.UserData = sharedCancelUserData
+
+			continue
+		}
+
+		req.prep(sqe)
+		sqe.UserData = req.id
+		sqe.Flags &^= SqeIOLink | SqeIOHardlink
+		s.inflight[req.id] = req.callback
+	}
+}
+
+func (s *SharedRing) reap() {
+	for cqe := range s.ring.Completions() {
+		switch cqe.UserData {
+		case sharedWakeUserData:
+			if !cqe.More() {
+				s.armed = false
+			}
+			var value [8]byte
+			_, _ = unix.Read(s.wakeFd, value[:])
+		case sharedCancelUserData:
+		default:
+			callback, ok := s.inflight[cqe.UserData]
+			if !ok {
+				continue
+			}
+			if !cqe.More() {
+				delete(s.inflight, cqe.UserData)
+			}
+			callback(cqe)
+		}
+	}
+}
+
+// shutdown submits the requests staged before Close, cancels everything in
+// flight and reaps the completions until deadline.
+func (s *SharedRing) shutdown(deadline time.Time) {
+	_ = s.submitStaged()
+
+	sqe, err := s.getSQE()
+	if err != nil || sqe == nil {
+		return
+	}
+	sqe.PrepareCancel64(0, int(AsyncCancelAny|AsyncCancelAll))
+	sqe.UserData = sharedCancelUserData
+	_, _ = s.ring.Submit()
+
+	for len(s.inflight) > 0 {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return
+		}
+
+		ts := syscall.NsecToTimespec(remaining.Nanoseconds())
+		_, err = s.ring.WaitCQETimeout(&ts)
+		runtime.KeepAlive(ts)
+		if err != nil && !sharedTemporary(err) {
+			return
+		}
+		s.reap()
+	}
+}
+
+// failAll completes the requests which never got a completion from the
+// kernel with ECANCELED.
+func (s *SharedRing) failAll() {
+	cancelled := func(id uint64, callback func(cqe *CompletionQueueEvent)) {
+		callback(&CompletionQueueEvent{UserData: id, Res: -int32(syscall.ECANCELED)})
+	}
+
+	for id, callback := range s.inflight {
+		delete(s.inflight, id)
+		cancelled(id, callback)
+	}
+	for _, req := range s.backlog {
+		if !req.cancel {
+			cancelled(req.id, req.callback)
+		}
+	}
+	s.backlog = nil
+	for req := s.queue.pop(); req != nil; req = s.queue.pop() {
+		if !req.cancel {
+			cancelled(req.id, req.callback)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func TestSharedRingConcurrentSubmit(t *testing.T) {
+	shared, err := NewSharedRing(8)
+	NoError(t, err)
+
+	const (
+		goroutines = 8
+		perRoutine = 100
+	)
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		seen = make(map[uint64]int32)
+	)
+
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			results := make(chan CompletionQueueEvent, 1)
+			for i := 0; i < perRoutine; i++ {
+				id, err := shared.SubmitChan(func(sqe *SubmissionQueueEntry) { sqe.PrepareNop() }, results)
+				NoError(t, err)
+
+				cqe := <-results
+				Equal(t, id, cqe.UserData)
+
+				mu.Lock()
+				seen[id] = cqe.Res
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	Len(t, seen, goroutines*perRoutine)
+	NoError(t, shared.Close())
+	ErrorIs(t, shared.Close(), ErrRingClosed)
+
+	_, err = shared.SubmitCallback(func(sqe *SubmissionQueueEntry) { sqe.PrepareNop() }, nil)
+	ErrorIs(t, err, ErrRingClosed)
+}
+
+func TestSharedRingCancel(t *testing.T) {
+	shared, err := NewSharedRing(8)
+	NoError(t, err)
+
+	defer shared.Close()
+
+	reader, writer, err := os.Pipe()
+	NoError(t, err)
+	defer reader.Close()
+	defer writer.Close()
+
+	buf := make([]byte, 8)
+	done := make(chan int32, 1)
+	id, err := shared.SubmitCallback(func(sqe *SubmissionQueueEntry) {
+		sqe.PrepareRead(int(reader.Fd()), uintptr(unsafe.Pointer(&buf[0])), uint32(len(buf)), 0)
+	}, func(cqe *CompletionQueueEvent) {
+		done <- cqe.Res
+	})
+	NoError(t, err)
+
+	select {
+	case <-done:
+		t.Fatal("read completed before being cancelled")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	NoError(t, shared.Cancel(id))
+	Equal(t, -int32(syscall.ECANCELED), <-done)
+}
+
+func TestSharedRingCloseCancelsInFlight(t *testing.T) {
+	shared, err := NewSharedRing(8)
+	NoError(t, err)
+
+	reader, writer, err := os.Pipe()
+	NoError(t, err)
+	defer reader.Close()
+	defer writer.Close()
+
+	buf := make([]byte, 8)
+	results := make(chan CompletionQueueEvent, 1)
+	_, err = shared.SubmitChan(func(sqe *SubmissionQueueEntry) {
+		sqe.PrepareRead(int(reader.Fd()), uintptr(unsafe.Pointer(&buf[0])), uint32(len(buf)), 0)
+	}, results)
+	NoError(t, err)
+
+	NoError(t, shared.Close())
+	cqe := <-results
+	ErrorIs(t, cqe.Err(), syscall.ECANCELED)
+}
+
+func TestMPSCQueue(t *testing.T) {
+	var queue mpscQueue
+	queue.init()
+
+	True(t, queue.empty())
+	Nil(t, queue.pop())
+
+	for i := uint64(1); i <= 3; i++ {
+		queue.push(&sharedRequest{id: i})
+	}
+	False(t, queue.empty())
+
+	for i := uint64(1); i <= 3; i++ {
+		req := queue.pop()
+		NotNil(t, req)
+		Equal(t, i, req.id)
+	}
+	Nil(t, queue.pop())
+	True(t, queue.empty())
+}
+
+func TestSharedRingSingleIssuer(t *testing.T) {
+	shared, err := NewSharedRing(8, WithFlags(SetupSingleIssuer|SetupDeferTaskrun))
+	NoError(t, err)
+
+	defer shared.Close()
+
+	results := make(chan CompletionQueueEvent, 1)
+	for i := 0; i < 10; i++ {
+		_, err = shared.SubmitChan(func(sqe *SubmissionQueueEntry) { sqe.PrepareNop() }, results)
+		NoError(t, err)
+		cqe := <-results
+		NoError(t, cqe.Err())
+	}
+}
@@ -68,6 +68,25 @@ func (ring *Ring) Enter2(
 	return uint(consumed), nil
 }
 
+// enter is Enter2 with an argument which is not a pointer, like the offset
+// into a registered wait region.
+func (ring *Ring) enter(submitted, waitNr, flags uint32, arg, size uintptr) (uint, error) {
+	consumed, _, errno := syscall.Syscall6(
+		sysEnter,
+		uintptr(ring.enterRingFd),
+		uintptr(submitted),
+		uintptr(waitNr),
+		uintptr(flags),
+		arg,
+		size,
+	)
+	if errno > 0 {
+		return 0, errno
+	}
+
+	return uint(consumed), nil
+}
+
 // liburing: io_uring_setup - https://manpages.debian.org/unstable/liburing-dev/io_uring_setup.2.en.html
 func Setup(entries uint32, p *Params) (uint, error) {
 	fd, _, errno := syscall.Syscall(sysSetup, uintptr(entries), uintptr(unsafe.Pointer(p)), 0)
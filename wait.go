@@ -0,0 +1,181 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"errors"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// WaitOption configures WaitCQEsWithOptions and SubmitAndWaitWithOptions.
+type WaitOption func(*waitOptions)
+
+type waitOptions struct {
+	minWait  time.Duration
+	timeout  time.Duration
+	deadline time.Time
+}
+
+// WithMinWait lets the kernel batch completions: the wait returns after
+// minWait once at least one completion is available, even if fewer than
+// the requested number arrived. Kernels without FeatMinTimeout ignore it.
+func WithMinWait(minWait time.Duration) WaitOption {
+	return func(o *waitOptions) {
+		o.minWait = minWait
+	}
+}
+
+// WithTimeout limits the wait to timeout.
+func WithTimeout(timeout time.Duration) WaitOption {
+	return func(o *waitOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithDeadline limits the wait to an absolute deadline. On Linux 6.12 and
+// newer it is converted once to the clock set with RegisterClock,
+// CLOCK_MONOTONIC by default, and passed as an absolute timer, so retries
+// after EINTR keep the same deadline. Older kernels get the relative timeout
+// left until the deadline.
+func WithDeadline(deadline time.Time) WaitOption {
+	return func(o *waitOptions) {
+		o.deadline = deadline
+	}
+}
+
+// WaitCQEsWithOptions waits for waitNr completions. It returns an error
+// wrapping syscall.ETIME if a timeout or deadline expires first.
+func (ring *Ring) WaitCQEsWithOptions(waitNr uint32, opts ...WaitOption) (*CompletionQueueEvent, error) {
+	return ring.waitWithOptions(false, waitNr, opts)
+}
+
+// SubmitAndWaitWithOptions submits the prepared entries and waits for
+// waitNr completions like WaitCQEsWithOptions.
+func (ring *Ring) SubmitAndWaitWithOptions(waitNr uint32, opts ...WaitOption) (*CompletionQueueEvent, error) {
+	return ring.waitWithOptions(true, waitNr, opts)
+}
+
+func (ring *Ring) waitWithOptions(submit bool, waitNr uint32, opts []WaitOption) (*CompletionQueueEvent, error) {
+	var options waitOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	deadline := options.deadline
+	if options.timeout > 0 {
+		timeoutDeadline := time.Now().Add(options.timeout)
+		if deadline.IsZero() || timeoutDeadline.Before(deadline) {
+			deadline = timeoutDeadline
+		}
+	}
+
+	var toSubmit uint32
+	if ring.features&FeatExtArg == 0 {
+		if !deadline.IsZero() {
+			ts := syscall.NsecToTimespec(max(time.Until(deadline), 0).Nanoseconds())
+			var err error
+			toSubmit, err = ring.internalSubmitTimeout(waitNr, &ts)
+			if err != nil {
+				return nil, err
+			}
+		} else if submit {
+			toSubmit = ring.internalFlushSQ()
+		}
+
+		return ring.internalGetCQE(toSubmit, waitNr, nil)
+	}
+
+	if submit {
+		toSubmit = ring.internalFlushSQ()
+	}
+
+	var (
+		ts  syscall.Timespec
+		abs bool
+		arg = GetEventsArg{sigMaskSz: nSig / szDivider}
+	)
+
+	getFlags := EnterExtArg
+	if options.minWait > 0 && ring.features&FeatMinTimeout != 0 {
+		arg.minWaitUsec = uint32(options.minWait.Microseconds())
+	}
+	if !deadline.IsZero() {
+		// The deadline is converted once, so an absolute timespec stays
+		// valid when an interrupted wait is retried.
+		if ts, abs = ring.deadlineTimespec(deadline); abs {
+			getFlags |= EnterAbsTimer
+		}
+		arg.ts = uint64(uintptr(unsafe.Pointer(&ts)))
+	}
+
+	data := getData{
+		submit:   toSubmit,
+		waitNr:   waitNr,
+		getFlags: getFlags,
+		sz:       int(unsafe.Sizeof(arg)),
+		hasTS:    !deadline.IsZero(),
+		arg:      unsafe.Pointer(&arg),
+	}
+
+	for {
+		cqe, err := ring.privateGetCQE(&data)
+		if errors.Is(err, syscall.EINTR) && !deadline.IsZero() {
+			if !abs {
+				ts = syscall.NsecToTimespec(max(time.Until(deadline), 0).Nanoseconds())
+			}
+
+			continue
+		}
+		runtime.KeepAlive(data)
+		runtime.KeepAlive(arg)
+		runtime.KeepAlive(ts)
+
+		return cqe, err
+	}
+}
+
+// absTimerMinKernel is the first kernel accepting EnterAbsTimer.
+var absTimerMinKernel = KernelVersion{Kernel: 6, Major: 12}
+
+// deadlineTimespec converts the deadline to an absolute timespec of the ring
+// clock and reports true if the kernel supports absolute timers. Otherwise
+// it returns the relative timeout left until the deadline.
+func (ring *Ring) deadlineTimespec(deadline time.Time) (syscall.Timespec, bool) {
+	caps, err := GetCapabilities()
+	if err != nil || kernelOlderThan(caps.Kernel, absTimerMinKernel) {
+		return syscall.NsecToTimespec(max(time.Until(deadline), 0).Nanoseconds()), false
+	}
+
+	var now unix.Timespec
+	if err = unix.ClockGettime(ring.clockID, &now); err != nil {
+		return syscall.NsecToTimespec(max(time.Until(deadline), 0).Nanoseconds()), false
+	}
+
+	return syscall.NsecToTimespec(now.Nano() + time.Until(deadline).Nanoseconds()), true
+}
@@ -0,0 +1,138 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func TestWaitCQEsWithTimeout(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	start := time.Now()
+	cqe, err := ring.WaitCQEsWithOptions(1, WithTimeout(20*time.Millisecond))
+	ErrorIs(t, err, syscall.ETIME)
+	Nil(t, cqe)
+	GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+
+	ring.GetSQE().PrepareNop()
+	cqe, err = ring.SubmitAndWaitWithOptions(1, WithTimeout(time.Second))
+	NoError(t, err)
+	NotNil(t, cqe)
+	ring.CQESeen(cqe)
+}
+
+func TestWaitCQEsWithDeadline(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	start := time.Now()
+	_, err = ring.WaitCQEsWithOptions(1, WithDeadline(start.Add(20*time.Millisecond)))
+	ErrorIs(t, err, syscall.ETIME)
+	GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+	Less(t, time.Since(start), time.Second)
+
+	// The earlier of the timeout and the deadline wins.
+	start = time.Now()
+	_, err = ring.WaitCQEsWithOptions(1,
+		WithDeadline(start.Add(time.Hour)), WithTimeout(20*time.Millisecond))
+	ErrorIs(t, err, syscall.ETIME)
+	Less(t, time.Since(start), time.Second)
+
+	// A deadline in the past does not block.
+	_, err = ring.WaitCQEsWithOptions(1, WithDeadline(start.Add(-time.Second)))
+	ErrorIs(t, err, syscall.ETIME)
+}
+
+func TestWaitCQEsWithRegisteredClock(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	_, err = ring.RegisterClock(&ClockRegister{ClockID: unix.CLOCK_BOOTTIME})
+	if err != nil {
+		t.Skipf("RegisterClock: %v", err)
+	}
+
+	start := time.Now()
+	_, err = ring.WaitCQEsWithOptions(1, WithDeadline(start.Add(20*time.Millisecond)))
+	ErrorIs(t, err, syscall.ETIME)
+	GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+	Less(t, time.Since(start), time.Second)
+}
+
+func TestDeadlineTimespec(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	caps, err := GetCapabilities()
+	NoError(t, err)
+
+	ts, abs := ring.deadlineTimespec(time.Now().Add(time.Second))
+	if kernelOlderThan(caps.Kernel, absTimerMinKernel) {
+		False(t, abs)
+		InDelta(t, time.Second.Nanoseconds(), ts.Nano(), float64(100*time.Millisecond))
+
+		return
+	}
+
+	True(t, abs)
+	var now unix.Timespec
+	NoError(t, unix.ClockGettime(unix.CLOCK_MONOTONIC, &now))
+	InDelta(t, now.Nano()+time.Second.Nanoseconds(), ts.Nano(), float64(100*time.Millisecond))
+}
+
+func TestWaitCQEsWithMinWait(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	if ring.features&FeatMinTimeout == 0 {
+		t.Skip("FeatMinTimeout not supported")
+	}
+
+	ring.GetSQE().PrepareNop()
+	start := time.Now()
+	cqe, err := ring.SubmitAndWaitWithOptions(4,
+		WithMinWait(10*time.Millisecond), WithTimeout(5*time.Second))
+	NoError(t, err)
+	NotNil(t, cqe)
+	Less(t, time.Since(start), time.Second)
+	Equal(t, uint32(1), ring.CQReady())
+}
@@ -0,0 +1,190 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// WaitRegion is an array of wait arguments registered with the kernel.
+// Waits refer to an entry by index instead of passing a fresh GetEventsArg
+// on every call.
+type WaitRegion struct {
+	ring    *Ring
+	ptr     unsafe.Pointer
+	size    uintptr
+	entries int
+}
+
+// RegisterWaitRegion allocates and registers a region of entries wait
+// arguments. The ring must have been created with SetupRDisabled and not be
+// enabled yet; the region stays registered until the ring exits.
+func (ring *Ring) RegisterWaitRegion(entries int) (*WaitRegion, error) {
+	if ring.waitRegion != nil {
+		return nil, fmt.Errorf("wait region already registered: %w", syscall.EBUSY)
+	}
+	if ring.flags&SetupRDisabled == 0 {
+		return nil, fmt.Errorf("wait region requires a SetupRDisabled ring: %w", syscall.EINVAL)
+	}
+	if entries <= 0 {
+		return nil, fmt.Errorf("wait region of %d entries: %w", entries, syscall.EINVAL)
+	}
+
+	caps, err := GetCapabilities()
+	if err != nil {
+		return nil, err
+	}
+	if err = caps.SupportsRegister(RegisterMemRegion); err != nil {
+		return nil, err
+	}
+
+	size := uintptr(alignUp(uint64(entries)*uint64(unsafe.Sizeof(RegWait{})), uint64(os.Getpagesize())))
+	ptr, err := sysMmap(0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED|syscall.MAP_ANONYMOUS, -1, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	desc := &RegionDesc{
+		UserAddr: uint64(uintptr(ptr)),
+		Size:     uint64(size),
+		Flags:    MemRegionTypeUser,
+	}
+	reg := &MemRegionReg{
+		RegionUptr: uint64(uintptr(unsafe.Pointer(desc))),
+		Flags:      MemRegionRegWaitArg,
+	}
+
+	_, err = ring.RegisterRegion(reg)
+	runtime.KeepAlive(desc)
+	if err != nil {
+		_ = sysMunmap(uintptr(ptr), size)
+
+		return nil, err
+	}
+
+	ring.waitRegion = &WaitRegion{
+		ring:    ring,
+		ptr:     ptr,
+		size:    size,
+		entries: int(size / unsafe.Sizeof(RegWait{})),
+	}
+
+	return ring.waitRegion, nil
+}
+
+// Len returns the number of entries, which may exceed the requested one
+// since the region is rounded up to whole pages.
+func (r *WaitRegion) Len() int {
+	return r.entries
+}
+
+// Entry returns the wait arguments at index. It panics if index is out of
+// range.
+func (r *WaitRegion) Entry(index int) *RegWait {
+	if index < 0 || index >= r.entries {
+		panic(fmt.Sprintf("wait region index %d out of range [0, %d)", index, r.entries))
+	}
+
+	return (*RegWait)(unsafe.Add(r.ptr, uintptr(index)*unsafe.Sizeof(RegWait{})))
+}
+
+// Set fills the entry at index with a relative timeout and a minimum wait
+// time. A zero timeout waits without a time limit.
+func (r *WaitRegion) Set(index int, timeout, minWait time.Duration) {
+	entry := r.Entry(index)
+	*entry = RegWait{MinWaitUsec: uint32(minWait.Microseconds())}
+	if timeout > 0 {
+		entry.Ts = syscall.NsecToTimespec(timeout.Nanoseconds())
+		entry.Flags = RegWaitTs
+	}
+}
+
+func (r *WaitRegion) free() {
+	_ = sysMunmap(uintptr(r.ptr), r.size)
+	r.ptr = nil
+	r.entries = 0
+}
+
+// liburing: io_uring_wait_cqes_reg
+func (ring *Ring) WaitCQEsReg(waitNr uint32, index int) (*CompletionQueueEvent, error) {
+	return ring.waitReg(false, waitNr, index)
+}
+
+// liburing: io_uring_submit_and_wait_reg
+func (ring *Ring) SubmitAndWaitReg(waitNr uint32, index int) (*CompletionQueueEvent, error) {
+	return ring.waitReg(true, waitNr, index)
+}
+
+func (ring *Ring) waitReg(submit bool, waitNr uint32, index int) (*CompletionQueueEvent, error) {
+	if ring.waitRegion == nil {
+		return nil, fmt.Errorf("no wait region registered: %w", syscall.EINVAL)
+	}
+	if index < 0 || index >= ring.waitRegion.entries {
+		return nil, fmt.Errorf("wait region index %d: %w", index, syscall.EINVAL)
+	}
+
+	var toSubmit uint32
+	if submit {
+		toSubmit = ring.internalFlushSQ()
+	}
+	offset := uintptr(index) * unsafe.Sizeof(RegWait{})
+
+	for {
+		var available uint32
+
+		cqe, err := internalPeekCQE(ring, &available)
+		if err != nil {
+			return nil, err
+		}
+		if cqe != nil && available >= waitNr && toSubmit == 0 {
+			return cqe, nil
+		}
+
+		flags := EnterGetEvents | EnterExtArg | EnterExtArgReg
+		ring.sqRingNeedsEnter(toSubmit, &flags)
+		if ring.intFlags&IntFlagRegRing != 0 {
+			flags |= EnterRegisteredRing
+		}
+
+		submitted, err := ring.enter(toSubmit, waitNr, flags, offset, unsafe.Sizeof(RegWait{}))
+		if err != nil {
+			return nil, err
+		}
+		toSubmit -= uint32(submitted)
+
+		cqe, err = internalPeekCQE(ring, nil)
+		if err != nil || cqe != nil {
+			return cqe, err
+		}
+		// Like io_uring_get_cqe, a wait for nothing enters only once.
+		if waitNr == 0 && toSubmit == 0 {
+			return nil, syscall.EAGAIN
+		}
+	}
+}
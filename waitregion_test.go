@@ -0,0 +1,94 @@
+// MIT License
+//
+// Copyright (c) 2023 Paweł Gaczyński
+//
+// Permission is hereby granted, free of charge, to any person obtaining a
+// copy of this software and associated documentation files (the
+// "Software"), to deal in the Software without restriction, including
+// without limitation the rights to use, copy, modify, merge, publish,
+// distribute, sublicense, and/or sell copies of the Software, and to
+// permit persons to whom the Software is furnished to do so, subject to
+// the following conditions:
+//
+// The above copyright notice and this permission notice shall be included
+// in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS
+// OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF
+// MERCHANTABILITY, FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT.
+// IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER IN AN ACTION OF CONTRACT,
+// TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE
+// SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package giouring
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	. "github.com/stretchr/testify/require"
+)
+
+func TestWaitRegion(t *testing.T) {
+	ring, err := NewRingWithOptions(8, WithFlags(SetupRDisabled))
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	region, err := ring.RegisterWaitRegion(4)
+	if err != nil {
+		t.Skipf("RegisterWaitRegion: %v", err)
+	}
+	_, err = ring.RegisterWaitRegion(4)
+	ErrorIs(t, err, syscall.EBUSY)
+
+	_, err = ring.EnableRings()
+	NoError(t, err)
+
+	GreaterOrEqual(t, region.Len(), 4)
+	Panics(t, func() { region.Entry(region.Len()) })
+
+	region.Set(0, 20*time.Millisecond, 0)
+	region.Set(1, time.Second, 0)
+
+	start := time.Now()
+	_, err = ring.WaitCQEsReg(1, 0)
+	ErrorIs(t, err, syscall.ETIME)
+	GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+
+	_, err = ring.WaitCQEsReg(0, 1)
+	ErrorIs(t, err, syscall.EAGAIN)
+
+	ring.GetSQE().PrepareNop()
+	cqe, err := ring.SubmitAndWaitReg(1, 1)
+	NoError(t, err)
+	NotNil(t, cqe)
+	ring.CQESeen(cqe)
+
+	ring.GetSQE().PrepareNop()
+	cqe, err = ring.SubmitAndWaitReg(0, 1)
+	if errors.Is(err, syscall.EAGAIN) {
+		cqe, err = ring.WaitCQEsReg(1, 1)
+	}
+	NoError(t, err)
+	NotNil(t, cqe)
+	ring.CQESeen(cqe)
+
+	_, err = ring.WaitCQEsReg(1, region.Len())
+	ErrorIs(t, err, syscall.EINVAL)
+}
+
+func TestWaitRegionRequiresDisabledRing(t *testing.T) {
+	ring, err := CreateRing(8)
+	NoError(t, err)
+
+	defer ring.QueueExit()
+
+	_, err = ring.RegisterWaitRegion(4)
+	ErrorIs(t, err, syscall.EINVAL)
+	_, err = ring.WaitCQEsReg(1, 0)
+	ErrorIs(t, err, syscall.EINVAL)
+}